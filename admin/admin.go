@@ -0,0 +1,193 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/routing"
+	"github.com/sirupsen/logrus"
+)
+
+// QueueInspectionTimeout limits how long admin API waits for RabbitMQ when it inspects wrapper queues
+const QueueInspectionTimeout = 5 * time.Second
+
+// Actions are the operations admin API triggers on JobRouter
+type Actions struct {
+	// Drain stops reading new jobs, jobs that have already been read are routed
+	Drain func()
+	// Shutdown stops JobRouter like SIGTERM does
+	Shutdown func()
+}
+
+// Wrapper describes a configured wrapper, QueueDepth is nil when its queue can't be inspected and Error tells why
+type Wrapper struct {
+	Name       string `json:"name"`
+	Position   int    `json:"position"`
+	QueueDepth *int   `json:"queue_depth"`
+	Paused     bool   `json:"paused"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Admin serves the admin API, every request must send Token as a bearer token
+type Admin struct {
+	token     string
+	wrappers  []config.Queue
+	broker    broker.Broker
+	pauses    *routing.Pauses
+	decisions *routing.Decisions
+	actions   Actions
+	logger    logrus.FieldLogger
+	drainOnce sync.Once
+}
+
+// New creates Admin for wrappers, their queues are declared and inspected on jobBroker.
+// decisions holds the routing decisions recorded by the router, actions are logged to logger.
+func New(adminConfig config.Admin, wrappers []config.Queue, jobBroker broker.Broker, pauses *routing.Pauses, decisions *routing.Decisions, actions Actions, logger logrus.FieldLogger) *Admin {
+	for _, wrapper := range wrappers {
+		jobBroker.DeclareQueue(wrapper.Name)
+	}
+
+	return &Admin{
+		token:     adminConfig.Token,
+		wrappers:  wrappers,
+		broker:    jobBroker,
+		pauses:    pauses,
+		decisions: decisions,
+		actions:   actions,
+		logger:    logger,
+	}
+}
+
+// Handler serves admin API under /admin/, requests without admin token are rejected
+func (a *Admin) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/wrappers", a.listWrappers)
+	mux.HandleFunc("/admin/wrappers/", a.controlWrapper)
+	mux.HandleFunc("/admin/decisions", a.listDecisions)
+	mux.HandleFunc("/admin/drain", a.drain)
+	mux.HandleFunc("/admin/shutdown", a.shutdown)
+	return a.authenticate(mux)
+}
+
+// authenticate rejects requests that do not send admin token as a bearer token
+func (a *Admin) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "Invalid admin token.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Admin) listWrappers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), QueueInspectionTimeout)
+	defer cancel()
+
+	wrappers := make([]Wrapper, 0, len(a.wrappers))
+	for position, wrapper := range a.wrappers {
+		status := Wrapper{Name: wrapper.Name, Position: position + 1, Paused: a.pauses.Paused(wrapper.Name)}
+		depth, err := a.broker.QueueDepth(ctx, wrapper.Name)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.QueueDepth = &depth
+		}
+		wrappers = append(wrappers, status)
+	}
+	writeJSON(w, http.StatusOK, wrappers)
+}
+
+// controlWrapper pauses or resumes routing to the wrapper named in request path
+func (a *Admin) controlWrapper(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/wrappers/"), "/")
+	if len(parts) != 2 || (parts[1] != "pause" && parts[1] != "resume") {
+		writeError(w, http.StatusNotFound, "Unknown admin endpoint.")
+		return
+	}
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	wrapperName, action := parts[0], parts[1]
+	if !a.isWrapper(wrapperName) {
+		writeError(w, http.StatusNotFound, "Wrapper '"+wrapperName+"' does not exist.")
+		return
+	}
+
+	if action == "pause" {
+		a.pauses.Pause(wrapperName)
+		a.logger.WithField("wrapper", wrapperName).Info("Routing to wrapper has been paused through admin API.")
+	} else {
+		a.pauses.Resume(wrapperName)
+		a.logger.WithField("wrapper", wrapperName).Info("Routing to wrapper has been resumed through admin API.")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) isWrapper(name string) bool {
+	for _, wrapper := range a.wrappers {
+		if wrapper.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Admin) listDecisions(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.decisions.Recent())
+}
+
+func (a *Admin) drain(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	a.drainOnce.Do(func() {
+		a.logger.Info("JobRouter is drained through admin API, no more jobs are read.")
+		a.actions.Drain()
+	})
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *Admin) shutdown(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	a.logger.Info("Shutdown requested through admin API.")
+	a.actions.Shutdown()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// allowMethod answers 405 status code when request method is not method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed.")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{"error": message})
+}
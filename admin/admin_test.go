@@ -0,0 +1,150 @@
+// +build unit_tests
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/logging"
+	"github.com/a-castellano/music-manager-job-router/routing"
+)
+
+const testToken = "secret"
+
+type ActionsMock struct {
+	Drained  int
+	Shutdown int
+}
+
+func newTestAdmin(t *testing.T, recentDecisions int) (*Admin, *broker.Memory, *routing.Pauses, *ActionsMock, *routing.Decisions) {
+	memory := broker.NewMemory()
+	t.Cleanup(func() { memory.Close() })
+	pauses := routing.NewPauses()
+	decisions := routing.NewDecisions(recentDecisions)
+	actions := &ActionsMock{}
+	wrappers := []config.Queue{{Name: "first"}, {Name: "second"}}
+
+	adminAPI := New(config.Admin{Token: testToken, RecentDecisions: recentDecisions}, wrappers, memory, pauses, decisions, Actions{
+		Drain:    func() { actions.Drained++ },
+		Shutdown: func() { actions.Shutdown++ },
+	}, logging.Discard())
+	return adminAPI, memory, pauses, actions, decisions
+}
+
+func request(adminAPI *Admin, method string, path string, token string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	adminAPI.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequestsNeedToken(t *testing.T) {
+
+	adminAPI, _, _, actions, _ := newTestAdmin(t, 0)
+
+	if recorder := request(adminAPI, http.MethodPost, "/admin/shutdown", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Requests without token should answer 401, not %d.", recorder.Code)
+	}
+	if recorder := request(adminAPI, http.MethodPost, "/admin/shutdown", "wrong"); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Requests with a wrong token should answer 401, not %d.", recorder.Code)
+	}
+	if actions.Shutdown != 0 {
+		t.Errorf("Unauthenticated requests should not trigger any action.")
+	}
+}
+
+func TestListWrappers(t *testing.T) {
+
+	adminAPI, memory, pauses, _, _ := newTestAdmin(t, 0)
+	memory.Publish(context.Background(), "second", broker.Message{Body: []byte("job")})
+	pauses.Pause("first")
+
+	recorder := request(adminAPI, http.MethodGet, "/admin/wrappers", testToken)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Listing wrappers should answer 200, not %d.", recorder.Code)
+	}
+	var wrappers []Wrapper
+	json.Unmarshal(recorder.Body.Bytes(), &wrappers)
+	if len(wrappers) != 2 {
+		t.Fatalf("2 wrappers should be listed, not %d.", len(wrappers))
+	}
+	first, second := wrappers[0], wrappers[1]
+	if first.Name != "first" || first.Position != 1 || !first.Paused || first.QueueDepth == nil || *first.QueueDepth != 0 {
+		t.Errorf("First wrapper should be paused with an empty queue, it was %+v.", first)
+	}
+	if second.Name != "second" || second.Position != 2 || second.Paused || second.QueueDepth == nil || *second.QueueDepth != 1 {
+		t.Errorf("Second wrapper should have 1 job waiting, it was %+v.", second)
+	}
+}
+
+func TestPauseAndResumeWrapper(t *testing.T) {
+
+	adminAPI, _, pauses, _, _ := newTestAdmin(t, 0)
+
+	if recorder := request(adminAPI, http.MethodPost, "/admin/wrappers/first/pause", testToken); recorder.Code != http.StatusNoContent || !pauses.Paused("first") {
+		t.Errorf("Pausing a wrapper should answer 204 and pause it, it answered %d.", recorder.Code)
+	}
+	if recorder := request(adminAPI, http.MethodPost, "/admin/wrappers/first/resume", testToken); recorder.Code != http.StatusNoContent || pauses.Paused("first") {
+		t.Errorf("Resuming a wrapper should answer 204 and resume it, it answered %d.", recorder.Code)
+	}
+	if recorder := request(adminAPI, http.MethodPost, "/admin/wrappers/third/pause", testToken); recorder.Code != http.StatusNotFound {
+		t.Errorf("Pausing an unknown wrapper should answer 404, not %d.", recorder.Code)
+	}
+	if recorder := request(adminAPI, http.MethodPost, "/admin/wrappers/first/stop", testToken); recorder.Code != http.StatusNotFound {
+		t.Errorf("Unknown wrapper actions should answer 404, not %d.", recorder.Code)
+	}
+	if recorder := request(adminAPI, http.MethodGet, "/admin/wrappers/first/pause", testToken); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Pausing a wrapper with GET should answer 405, not %d.", recorder.Code)
+	}
+}
+
+func TestListDecisions(t *testing.T) {
+
+	adminAPI, _, _, _, decisions := newTestAdmin(t, 2)
+
+	decisions.Record(routing.Decision{JobID: "first", Outcome: logging.Published, Queue: "first"})
+	decisions.Record(routing.Decision{JobID: "second", Outcome: logging.Succeeded})
+	decisions.Record(routing.Decision{JobID: "third", Outcome: logging.DeadLettered, Error: "Test."})
+
+	recorder := request(adminAPI, http.MethodGet, "/admin/decisions", testToken)
+	var recent []routing.Decision
+	json.Unmarshal(recorder.Body.Bytes(), &recent)
+	if len(recent) != 2 {
+		t.Fatalf("Only the 2 most recent decisions should be kept, %d were listed.", len(recent))
+	}
+	if recent[0].JobID != "second" || recent[1].JobID != "third" {
+		t.Errorf("Decisions should be listed from the oldest to the newest, they were %+v.", recent)
+	}
+	if recent[1].Outcome != logging.DeadLettered || recent[1].Error != "Test." || recent[1].Time.IsZero() {
+		t.Errorf("Decision should keep its outcome, error and time, it was %+v.", recent[1])
+	}
+}
+
+func TestDrainAndShutdown(t *testing.T) {
+
+	adminAPI, _, _, actions, _ := newTestAdmin(t, 0)
+
+	request(adminAPI, http.MethodPost, "/admin/drain", testToken)
+	if recorder := request(adminAPI, http.MethodPost, "/admin/drain", testToken); recorder.Code != http.StatusAccepted {
+		t.Errorf("Draining should answer 202, not %d.", recorder.Code)
+	}
+	if actions.Drained != 1 {
+		t.Errorf("JobRouter should be drained once, it was drained %d times.", actions.Drained)
+	}
+
+	if recorder := request(adminAPI, http.MethodPost, "/admin/shutdown", testToken); recorder.Code != http.StatusAccepted || actions.Shutdown != 1 {
+		t.Errorf("Shutdown should answer 202 and stop JobRouter, it answered %d.", recorder.Code)
+	}
+	if recorder := request(adminAPI, http.MethodGet, "/admin/shutdown", testToken); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Shutdown with GET should answer 405, not %d.", recorder.Code)
+	}
+}
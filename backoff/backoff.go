@@ -0,0 +1,57 @@
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultInitialDelay = time.Second
+	DefaultMaxDelay     = 30 * time.Second
+)
+
+// Backoff computes exponentially growing delays with jitter, each delay doubles the previous one until MaxDelay is reached
+type Backoff struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	attempt      uint
+}
+
+// New returns a Backoff, zero delays are replaced by default ones
+func New(initialDelay time.Duration, maxDelay time.Duration) *Backoff {
+	if initialDelay <= 0 {
+		initialDelay = DefaultInitialDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	if maxDelay < initialDelay {
+		maxDelay = initialDelay
+	}
+	return &Backoff{InitialDelay: initialDelay, MaxDelay: maxDelay}
+}
+
+// Next returns the delay to wait before the next attempt, it is chosen randomly between half and the whole exponential delay
+func (b *Backoff) Next() time.Duration {
+	delay := b.MaxDelay
+	// Avoid overflows once delay has reached MaxDelay
+	if b.attempt < 32 {
+		exponentialDelay := b.InitialDelay << b.attempt
+		if exponentialDelay > 0 && exponentialDelay < b.MaxDelay {
+			delay = exponentialDelay
+		}
+	}
+	b.attempt++
+	halfDelay := delay / 2
+	return halfDelay + time.Duration(rand.Int63n(int64(delay-halfDelay)+1))
+}
+
+// Attempts returns how many delays have been returned since last reset
+func (b *Backoff) Attempts() int {
+	return int(b.attempt)
+}
+
+// Reset starts again from InitialDelay
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,62 @@
+// +build integration_tests unit_tests
+
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDefaults(t *testing.T) {
+
+	b := New(0, 0)
+
+	if b.InitialDelay != DefaultInitialDelay {
+		t.Errorf("InitialDelay should be %s, not %s.", DefaultInitialDelay, b.InitialDelay)
+	}
+	if b.MaxDelay != DefaultMaxDelay {
+		t.Errorf("MaxDelay should be %s, not %s.", DefaultMaxDelay, b.MaxDelay)
+	}
+}
+
+func TestBackoffGrowsUntilMaxDelay(t *testing.T) {
+
+	b := New(100*time.Millisecond, time.Second)
+
+	expectedMaxDelays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for attempt, expectedMaxDelay := range expectedMaxDelays {
+		delay := b.Next()
+		if delay < expectedMaxDelay/2 || delay > expectedMaxDelay {
+			t.Errorf("Delay for attempt %d should be between %s and %s, not %s.", attempt, expectedMaxDelay/2, expectedMaxDelay, delay)
+		}
+	}
+	if b.Attempts() != len(expectedMaxDelays) {
+		t.Errorf("Attempts should be %d, not %d.", len(expectedMaxDelays), b.Attempts())
+	}
+}
+
+func TestBackoffReset(t *testing.T) {
+
+	b := New(100*time.Millisecond, time.Second)
+
+	for i := 0; i < 5; i++ {
+		b.Next()
+	}
+	b.Reset()
+	delay := b.Next()
+	if delay > 100*time.Millisecond {
+		t.Errorf("Delay after reset should not be greater than InitialDelay, it was %s.", delay)
+	}
+}
+
+func TestBackoffDoesNotOverflow(t *testing.T) {
+
+	b := New(time.Second, time.Hour)
+
+	for i := 0; i < 100; i++ {
+		delay := b.Next()
+		if delay <= 0 || delay > time.Hour {
+			t.Fatalf("Delay for attempt %d is out of bounds: %s.", i, delay)
+		}
+	}
+}
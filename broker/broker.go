@@ -0,0 +1,83 @@
+package broker
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNacked         = errors.New("Publishing was nacked by RabbitMQ.")
+	ErrConfirmTimeout = errors.New("Publishing confirmation timed out.")
+	ErrClosed         = errors.New("Broker is closed.")
+)
+
+// Message is the content published to or received from a queue
+type Message struct {
+	Body    []byte
+	Headers map[string]interface{}
+}
+
+// acknowledger is implemented by amqp.Delivery and by in-memory deliveries
+type acknowledger interface {
+	Ack(multiple bool) error
+	Nack(multiple, requeue bool) error
+	Reject(requeue bool) error
+}
+
+// Delivery is a message received from a queue, it stays unacknowledged until Ack, Nack or Reject are called
+type Delivery struct {
+	Message
+	acknowledger acknowledger
+	// lost is closed when the channel delivery came from is closed
+	lost <-chan struct{}
+}
+
+// Lost reports whether the channel delivery came from has been closed, it can't be acknowledged anymore and broker delivers it again
+func (d Delivery) Lost() bool {
+	select {
+	case <-d.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ack tells broker that delivery has been processed
+func (d Delivery) Ack(multiple bool) error {
+	return d.acknowledger.Ack(multiple)
+}
+
+// Nack tells broker that delivery couldn't be processed, it is returned to its queue when requeue is true
+func (d Delivery) Nack(multiple, requeue bool) error {
+	return d.acknowledger.Nack(multiple, requeue)
+}
+
+// Reject tells broker that delivery can't be processed, it is returned to its queue when requeue is true
+func (d Delivery) Reject(requeue bool) error {
+	return d.acknowledger.Reject(requeue)
+}
+
+// Broker is the message broker JobRouter reads jobs from and sends jobs to.
+// Queues and bindings are declared when broker connects, so they must be set up before using it.
+type Broker interface {
+	// DeclareQueue makes broker declare a durable queue
+	DeclareQueue(queue string)
+	// Bind makes broker declare a durable fanout exchange bound to queue
+	Bind(exchange string, queue string)
+	// Connect connects to broker declaring its queues, other methods connect if needed
+	Connect(ctx context.Context) error
+	// Connected reports whether broker is connected with its queues declared, it does not wait for reconnections
+	Connected() bool
+	// Consume starts consuming queue, deliveries channel is closed when consumers are cancelled or connection is lost
+	Consume(ctx context.Context, queue string) (<-chan Delivery, error)
+	// Cancel stops consumers, received deliveries can still be acknowledged
+	Cancel()
+	// Publish sends message to queue
+	Publish(ctx context.Context, queue string, message Message) error
+	// PublishToExchange sends message to exchange using routingKey
+	PublishToExchange(ctx context.Context, exchange string, routingKey string, message Message) error
+	// QueueDepth returns how many messages are waiting in queue, queue must have been declared
+	QueueDepth(ctx context.Context, queue string) (int, error)
+	// Close releases broker resources, broker can't be used after closing it
+	Close() error
+}
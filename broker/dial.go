@@ -0,0 +1,65 @@
+package broker
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/tlsconfig"
+	"github.com/streadway/amqp"
+)
+
+const (
+	DefaultHeartbeat      = 10 * time.Second
+	DefaultLocale         = "en_US"
+	DefaultConnectionName = "music-manager-job-router"
+)
+
+// URL returns RabbitMQ connection string for server, amqps is used when TLS is enabled
+func URL(server config.Server) string {
+	connectionURL := url.URL{
+		Scheme: "amqp",
+		User:   url.UserPassword(server.User, server.Password),
+		Host:   server.Host + ":" + strconv.Itoa(server.Port),
+		Path:   "/",
+	}
+	if server.TLS {
+		connectionURL.Scheme = "amqps"
+	}
+	if server.VHost != "" && server.VHost != "/" {
+		connectionURL.Path = "/" + server.VHost
+		connectionURL.RawPath = "/" + url.PathEscape(server.VHost)
+	}
+	return connectionURL.String()
+}
+
+// Dial opens a connection to RabbitMQ server, every Session connects through it so consumers and publishers share connection settings
+func Dial(server config.Server) (*amqp.Connection, error) {
+	// Empty vhost is taken from URL, it is the default one
+	amqpConfig := amqp.Config{
+		Vhost:      server.VHost,
+		Heartbeat:  server.Heartbeat,
+		Locale:     server.Locale,
+		Properties: amqp.Table{"connection_name": server.ConnectionName},
+	}
+	if amqpConfig.Heartbeat == 0 {
+		amqpConfig.Heartbeat = DefaultHeartbeat
+	}
+	if amqpConfig.Locale == "" {
+		amqpConfig.Locale = DefaultLocale
+	}
+	if server.ConnectionName == "" {
+		amqpConfig.Properties["connection_name"] = DefaultConnectionName
+	}
+
+	if server.TLS {
+		tlsConfig, err := tlsconfig.New(server.CAFile, server.CertFile, server.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		amqpConfig.TLSClientConfig = tlsConfig
+	}
+
+	return amqp.DialConfig(URL(server), amqpConfig)
+}
@@ -0,0 +1,376 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// memoryQueue keeps messages waiting to be consumed, notify is closed and replaced every time a message is added
+type memoryQueue struct {
+	messages []Message
+	notify   chan struct{}
+}
+
+// wakeUp notifies consumers waiting for queue messages
+func (q *memoryQueue) wakeUp() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// memoryConsumer is closed by Cancel through cancelled, stopped is closed once it has returned its pending message
+type memoryConsumer struct {
+	cancelled chan struct{}
+	stopped   chan struct{}
+}
+
+// memoryServer keeps the queues and exchanges shared by every connection of an in-memory broker
+type memoryServer struct {
+	mutex     sync.Mutex
+	queues    map[string]*memoryQueue
+	exchanges map[string][]string
+	refused   map[string]bool
+}
+
+// Memory is a Broker that keeps its queues in memory, it allows running and testing JobRouter without RabbitMQ.
+// Messages published to queues that have not been declared are dropped like RabbitMQ default exchange does.
+type Memory struct {
+	server *memoryServer
+	// mutex protects consumers, unacked, lost and closed, queues are protected by server mutex
+	mutex     sync.Mutex
+	consumers []memoryConsumer
+	// unacked keeps deliveries that have not been acknowledged in the order they were delivered
+	unacked []*memoryAcknowledger
+	// lost is closed by Disconnect, deliveries received before can't be acknowledged
+	lost   chan struct{}
+	closed bool
+}
+
+// NewMemory creates an empty in-memory broker
+func NewMemory() *Memory {
+	return &Memory{server: &memoryServer{
+		queues:    make(map[string]*memoryQueue),
+		exchanges: make(map[string][]string),
+		refused:   make(map[string]bool),
+	}, lost: make(chan struct{})}
+}
+
+// Connection returns a Memory that shares queues and exchanges with m, like another connection to the same RabbitMQ server.
+// Cancelling or closing it only stops its own consumers.
+func (m *Memory) Connection() *Memory {
+	return &Memory{server: m.server, lost: make(chan struct{})}
+}
+
+// DeclareQueue creates queue if it does not exist yet
+func (m *Memory) DeclareQueue(queue string) {
+	m.server.mutex.Lock()
+	defer m.server.mutex.Unlock()
+
+	m.server.declareQueue(queue)
+}
+
+func (s *memoryServer) declareQueue(queue string) *memoryQueue {
+	if _, ok := s.queues[queue]; !ok {
+		s.queues[queue] = &memoryQueue{notify: make(chan struct{})}
+	}
+	return s.queues[queue]
+}
+
+// Bind creates exchange and queue if they do not exist and binds them, messages published to exchange are sent to every bound queue
+func (m *Memory) Bind(exchange string, queue string) {
+	m.server.mutex.Lock()
+	defer m.server.mutex.Unlock()
+
+	m.server.declareQueue(queue)
+	for _, boundQueue := range m.server.exchanges[exchange] {
+		if boundQueue == queue {
+			return
+		}
+	}
+	m.server.exchanges[exchange] = append(m.server.exchanges[exchange], queue)
+}
+
+// Refuse makes broker nack messages published to queue, like RabbitMQ does when a queue is full or a resource alarm is raised
+func (m *Memory) Refuse(queue string) {
+	m.server.mutex.Lock()
+	defer m.server.mutex.Unlock()
+
+	m.server.refused[queue] = true
+}
+
+// Connect only fails when broker has been closed
+func (m *Memory) Connect(ctx context.Context) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Connected reports whether broker has not been closed
+func (m *Memory) Connected() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return !m.closed
+}
+
+// Consume returns deliveries from queue, unacknowledged deliveries are lost unless they are nacked or rejected with requeue
+// or connection is disconnected
+func (m *Memory) Consume(ctx context.Context, queue string) (<-chan Delivery, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	m.server.mutex.Lock()
+	memoryQueue, ok := m.server.queues[queue]
+	m.server.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Failed to consume queue %s: queue does not exist.", queue)
+	}
+
+	deliveries := make(chan Delivery)
+	consumer := memoryConsumer{cancelled: make(chan struct{}), stopped: make(chan struct{})}
+	m.consumers = append(m.consumers, consumer)
+	go m.consume(memoryQueue, deliveries, consumer, m.lost)
+	return deliveries, nil
+}
+
+func (m *Memory) consume(queue *memoryQueue, deliveries chan Delivery, consumer memoryConsumer, lost chan struct{}) {
+	defer close(consumer.stopped)
+	defer close(deliveries)
+	cancelled := consumer.cancelled
+	for {
+		m.server.mutex.Lock()
+		if len(queue.messages) == 0 {
+			notify := queue.notify
+			m.server.mutex.Unlock()
+			select {
+			case <-notify:
+				continue
+			case <-cancelled:
+				return
+			}
+		}
+		message := queue.messages[0]
+		queue.messages = queue.messages[1:]
+		m.server.mutex.Unlock()
+
+		acknowledger := &memoryAcknowledger{connection: m, queue: queue, message: message}
+		m.track(acknowledger)
+		select {
+		case deliveries <- Delivery{Message: message, acknowledger: acknowledger, lost: lost}:
+		case <-cancelled:
+			// Nobody received message, it goes back to its queue
+			m.forget(acknowledger)
+			m.server.requeue(queue, message)
+			return
+		}
+	}
+}
+
+// track keeps acknowledger until its delivery is acknowledged
+func (m *Memory) track(acknowledger *memoryAcknowledger) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.unacked = append(m.unacked, acknowledger)
+}
+
+// forget removes an acknowledged delivery from unacked ones
+func (m *Memory) forget(acknowledger *memoryAcknowledger) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for position, unacked := range m.unacked {
+		if unacked == acknowledger {
+			m.unacked = append(m.unacked[:position], m.unacked[position+1:]...)
+			return
+		}
+	}
+}
+
+// Disconnect behaves like losing this connection to RabbitMQ: consumers are stopped, deliveries that have not been acknowledged
+// go back to their queues and can't be acknowledged anymore. Connection can still be used afterwards.
+func (m *Memory) Disconnect() {
+	m.Cancel()
+
+	m.mutex.Lock()
+	unacked := m.unacked
+	m.unacked = nil
+	close(m.lost)
+	m.lost = make(chan struct{})
+	m.mutex.Unlock()
+
+	// Requeued messages go to the head of their queues, last delivered ones are requeued first to keep their order
+	for position := len(unacked) - 1; position >= 0; position-- {
+		if unacked[position].expire() {
+			m.server.requeue(unacked[position].queue, unacked[position].message)
+		}
+	}
+}
+
+// Cancel stops every consumer of this connection closing their deliveries channels, messages not delivered yet are kept in their queues
+func (m *Memory) Cancel() {
+	m.mutex.Lock()
+	consumers := m.consumers
+	m.consumers = nil
+	m.mutex.Unlock()
+
+	for _, consumer := range consumers {
+		close(consumer.cancelled)
+	}
+	for _, consumer := range consumers {
+		<-consumer.stopped
+	}
+}
+
+// Publish adds message to queue
+func (m *Memory) Publish(ctx context.Context, queue string, message Message) error {
+	return m.PublishToExchange(ctx, "", queue, message)
+}
+
+// PublishToExchange adds message to every queue bound to exchange, empty exchange sends message to routingKey queue
+func (m *Memory) PublishToExchange(ctx context.Context, exchange string, routingKey string, message Message) error {
+	if !m.Connected() {
+		return ErrClosed
+	}
+
+	m.server.mutex.Lock()
+	defer m.server.mutex.Unlock()
+
+	if exchange == "" {
+		if m.server.refused[routingKey] {
+			return ErrNacked
+		}
+		if queue, ok := m.server.queues[routingKey]; ok {
+			push(queue, message)
+		}
+		return nil
+	}
+	boundQueues, ok := m.server.exchanges[exchange]
+	if !ok {
+		return fmt.Errorf("Failed to publish to exchange %s: exchange does not exist.", exchange)
+	}
+	for _, queue := range boundQueues {
+		if m.server.refused[queue] {
+			return ErrNacked
+		}
+	}
+	for _, queue := range boundQueues {
+		push(m.server.queues[queue], message)
+	}
+	return nil
+}
+
+// Messages returns messages waiting in queue to be consumed
+func (m *Memory) Messages(queue string) []Message {
+	m.server.mutex.Lock()
+	defer m.server.mutex.Unlock()
+
+	memoryQueue, ok := m.server.queues[queue]
+	if !ok {
+		return nil
+	}
+	return append([]Message{}, memoryQueue.messages...)
+}
+
+// QueueDepth returns how many messages are waiting in queue, unacknowledged deliveries are not counted
+func (m *Memory) QueueDepth(ctx context.Context, queue string) (int, error) {
+	if !m.Connected() {
+		return 0, ErrClosed
+	}
+
+	m.server.mutex.Lock()
+	defer m.server.mutex.Unlock()
+
+	memoryQueue, ok := m.server.queues[queue]
+	if !ok {
+		return 0, fmt.Errorf("Failed to inspect queue %s: queue does not exist.", queue)
+	}
+	return len(memoryQueue.messages), nil
+}
+
+// Close stops consumers of this connection, it can't be used after closing it but other connections keep working
+func (m *Memory) Close() error {
+	m.mutex.Lock()
+	m.closed = true
+	m.mutex.Unlock()
+
+	m.Cancel()
+	return nil
+}
+
+func push(queue *memoryQueue, message Message) {
+	queue.messages = append(queue.messages, message)
+	queue.wakeUp()
+}
+
+func (s *memoryServer) requeue(queue *memoryQueue, message Message) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Requeued messages are delivered first, as RabbitMQ tries to keep their position
+	queue.messages = append([]Message{message}, queue.messages...)
+	queue.wakeUp()
+}
+
+// memoryAcknowledger acknowledges one in-memory delivery, multiple flag is ignored
+type memoryAcknowledger struct {
+	connection   *Memory
+	queue        *memoryQueue
+	message      Message
+	mutex        sync.Mutex
+	acknowledged bool
+	lost         bool
+}
+
+func (a *memoryAcknowledger) done() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.lost {
+		return errors.New("Delivery channel has been closed.")
+	}
+	if a.acknowledged {
+		return errors.New("Delivery has already been acknowledged.")
+	}
+	a.acknowledged = true
+	a.connection.forget(a)
+	return nil
+}
+
+// expire marks delivery as lost, it returns false when delivery had already been acknowledged
+func (a *memoryAcknowledger) expire() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.acknowledged {
+		return false
+	}
+	a.lost = true
+	return true
+}
+
+func (a *memoryAcknowledger) Ack(multiple bool) error {
+	return a.done()
+}
+
+func (a *memoryAcknowledger) Nack(multiple, requeue bool) error {
+	return a.Reject(requeue)
+}
+
+func (a *memoryAcknowledger) Reject(requeue bool) error {
+	if err := a.done(); err != nil {
+		return err
+	}
+	if requeue {
+		a.connection.server.requeue(a.queue, a.message)
+	}
+	return nil
+}
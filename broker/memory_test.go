@@ -0,0 +1,283 @@
+// +build integration_tests unit_tests
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, deliveries <-chan Delivery) Delivery {
+	select {
+	case delivery, ok := <-deliveries:
+		if !ok {
+			t.Fatalf("Deliveries channel should not be closed.")
+		}
+		return delivery
+	case <-time.After(time.Second):
+		t.Fatalf("No delivery has been received.")
+	}
+	return Delivery{}
+}
+
+func TestMemoryPublishAndConsume(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue("TestMemoryPublishAndConsume")
+
+	err := memory.Publish(context.Background(), "TestMemoryPublishAndConsume", Message{Body: []byte("first")})
+	if err != nil {
+		t.Fatalf("Publish should not fail, error was '%s'.", err.Error())
+	}
+
+	deliveries, err := memory.Consume(context.Background(), "TestMemoryPublishAndConsume")
+	if err != nil {
+		t.Fatalf("Consume should not fail, error was '%s'.", err.Error())
+	}
+	delivery := receive(t, deliveries)
+	if string(delivery.Body) != "first" {
+		t.Errorf("Received body should be 'first', not '%s'.", string(delivery.Body))
+	}
+	if delivery.Ack(false) != nil {
+		t.Errorf("First Ack should not fail.")
+	}
+	if delivery.Ack(false) == nil {
+		t.Errorf("Second Ack should fail.")
+	}
+
+	// Messages published while consuming are delivered too
+	memory.Publish(context.Background(), "TestMemoryPublishAndConsume", Message{Body: []byte("second")})
+	delivery = receive(t, deliveries)
+	if string(delivery.Body) != "second" {
+		t.Errorf("Received body should be 'second', not '%s'.", string(delivery.Body))
+	}
+	delivery.Ack(false)
+}
+
+func TestMemoryNackRequeuesMessage(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue("TestMemoryNackRequeuesMessage")
+	memory.Publish(context.Background(), "TestMemoryNackRequeuesMessage", Message{Body: []byte("requeued")})
+
+	deliveries, _ := memory.Consume(context.Background(), "TestMemoryNackRequeuesMessage")
+	receive(t, deliveries).Nack(false, true)
+
+	delivery := receive(t, deliveries)
+	if string(delivery.Body) != "requeued" {
+		t.Errorf("Nacked message should be delivered again, received body was '%s'.", string(delivery.Body))
+	}
+	delivery.Reject(false)
+	memory.Cancel()
+
+	if len(memory.Messages("TestMemoryNackRequeuesMessage")) != 0 {
+		t.Errorf("Rejected message without requeue should be dropped.")
+	}
+}
+
+func TestMemoryCancelClosesDeliveries(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue("TestMemoryCancelClosesDeliveries")
+
+	deliveries, _ := memory.Consume(context.Background(), "TestMemoryCancelClosesDeliveries")
+	memory.Cancel()
+
+	select {
+	case _, ok := <-deliveries:
+		if ok {
+			t.Errorf("No delivery should be received after cancelling consumers.")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Deliveries channel should be closed after cancelling consumers.")
+	}
+
+	memory.Publish(context.Background(), "TestMemoryCancelClosesDeliveries", Message{Body: []byte("waiting")})
+	if len(memory.Messages("TestMemoryCancelClosesDeliveries")) != 1 {
+		t.Errorf("Messages published without consumers should wait in queue.")
+	}
+}
+
+func TestMemoryPublishToExchange(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	memory.Bind("TestMemoryPublishToExchange", "first")
+	memory.Bind("TestMemoryPublishToExchange", "second")
+
+	headers := map[string]interface{}{"x-test": "TestMemoryPublishToExchange"}
+	err := memory.PublishToExchange(context.Background(), "TestMemoryPublishToExchange", "", Message{Body: []byte("fanout"), Headers: headers})
+	if err != nil {
+		t.Fatalf("PublishToExchange should not fail, error was '%s'.", err.Error())
+	}
+
+	for _, queue := range []string{"first", "second"} {
+		messages := memory.Messages(queue)
+		if len(messages) != 1 {
+			t.Fatalf("Queue %s should have 1 message, not %d.", queue, len(messages))
+		}
+		if messages[0].Headers["x-test"] != "TestMemoryPublishToExchange" {
+			t.Errorf("Message headers should be kept in queue %s.", queue)
+		}
+	}
+
+	err = memory.PublishToExchange(context.Background(), "Undeclared", "", Message{Body: []byte("lost")})
+	if err == nil {
+		t.Errorf("Publishing to an undeclared exchange should fail.")
+	}
+}
+
+func TestMemoryPublishToUndeclaredQueue(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+
+	err := memory.Publish(context.Background(), "TestMemoryPublishToUndeclaredQueue", Message{Body: []byte("dropped")})
+	if err != nil {
+		t.Errorf("Publishing to an undeclared queue should not fail.")
+	}
+	if memory.Messages("TestMemoryPublishToUndeclaredQueue") != nil {
+		t.Errorf("Publishing to an undeclared queue should not create it.")
+	}
+	_, err = memory.Consume(context.Background(), "TestMemoryPublishToUndeclaredQueue")
+	if err == nil {
+		t.Errorf("Consuming an undeclared queue should fail.")
+	}
+}
+
+func TestMemoryRefuse(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	memory.Bind("TestMemoryRefuse", "first")
+	memory.Bind("TestMemoryRefuse", "second")
+	memory.Refuse("second")
+
+	err := memory.PublishToExchange(context.Background(), "TestMemoryRefuse", "", Message{Body: []byte("refused")})
+	if !errors.Is(err, ErrNacked) {
+		t.Errorf("Publishing to an exchange bound to a refused queue should be nacked, error was '%v'.", err)
+	}
+	err = memory.Publish(context.Background(), "second", Message{Body: []byte("refused")})
+	if !errors.Is(err, ErrNacked) {
+		t.Errorf("Publishing to a refused queue should be nacked, error was '%v'.", err)
+	}
+	if len(memory.Messages("first")) != 0 || len(memory.Messages("second")) != 0 {
+		t.Errorf("Refused messages should not be added to any queue.")
+	}
+	if memory.Publish(context.Background(), "first", Message{Body: []byte("accepted")}) != nil || len(memory.Messages("first")) != 1 {
+		t.Errorf("Queues that are not refused should keep receiving messages.")
+	}
+}
+
+func TestMemoryDisconnect(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue("TestMemoryDisconnect")
+	memory.Publish(context.Background(), "TestMemoryDisconnect", Message{Body: []byte("first")})
+	memory.Publish(context.Background(), "TestMemoryDisconnect", Message{Body: []byte("second")})
+
+	deliveries, _ := memory.Consume(context.Background(), "TestMemoryDisconnect")
+	acked := receive(t, deliveries)
+	acked.Ack(false)
+	unacked := receive(t, deliveries)
+	if unacked.Lost() {
+		t.Errorf("Deliveries should not be lost before disconnecting.")
+	}
+
+	memory.Disconnect()
+	if _, open := <-deliveries; open {
+		t.Errorf("Deliveries channel should be closed when connection is lost.")
+	}
+	if !unacked.Lost() || unacked.Ack(false) == nil {
+		t.Errorf("Deliveries received before disconnecting should be lost and can't be acknowledged.")
+	}
+
+	// Unacknowledged message is delivered again
+	deliveries, err := memory.Consume(context.Background(), "TestMemoryDisconnect")
+	if err != nil {
+		t.Fatalf("Consume should not fail after disconnecting, error was '%s'.", err.Error())
+	}
+	redelivered := receive(t, deliveries)
+	if string(redelivered.Body) != "second" || redelivered.Lost() {
+		t.Errorf("Unacknowledged message should be delivered again, received body was '%s'.", string(redelivered.Body))
+	}
+	if redelivered.Ack(false) != nil {
+		t.Errorf("Redelivered message should be acknowledged.")
+	}
+	if len(memory.Messages("TestMemoryDisconnect")) != 0 {
+		t.Errorf("Acknowledged messages should not be delivered again.")
+	}
+}
+
+func TestMemoryClosed(t *testing.T) {
+
+	memory := NewMemory()
+	memory.DeclareQueue("TestMemoryClosed")
+	if !memory.Connected() {
+		t.Errorf("Broker should be connected until it is closed.")
+	}
+	memory.Close()
+
+	if memory.Connected() {
+		t.Errorf("Broker should not be connected once it is closed.")
+	}
+
+	if memory.Connect(context.Background()) != ErrClosed {
+		t.Errorf("Connect should fail with ErrClosed once broker is closed.")
+	}
+	if memory.Publish(context.Background(), "TestMemoryClosed", Message{}) != ErrClosed {
+		t.Errorf("Publish should fail with ErrClosed once broker is closed.")
+	}
+	if _, err := memory.Consume(context.Background(), "TestMemoryClosed"); err != ErrClosed {
+		t.Errorf("Consume should fail with ErrClosed once broker is closed.")
+	}
+}
+
+func TestMemoryQueueDepth(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue("TestMemoryQueueDepth")
+	memory.Publish(context.Background(), "TestMemoryQueueDepth", Message{Body: []byte("first")})
+	memory.Publish(context.Background(), "TestMemoryQueueDepth", Message{Body: []byte("second")})
+
+	depth, err := memory.QueueDepth(context.Background(), "TestMemoryQueueDepth")
+	if err != nil || depth != 2 {
+		t.Errorf("Queue should have 2 messages, depth was %d and error was '%v'.", depth, err)
+	}
+	if _, err := memory.QueueDepth(context.Background(), "TestMemoryQueueDepthUndeclared"); err == nil {
+		t.Errorf("Inspecting an undeclared queue should fail.")
+	}
+}
+
+func TestMemoryConnection(t *testing.T) {
+
+	memory := NewMemory()
+	defer memory.Close()
+	connection := memory.Connection()
+	memory.DeclareQueue("TestMemoryConnection")
+
+	memoryDeliveries, _ := memory.Consume(context.Background(), "TestMemoryConnection")
+	connection.Publish(context.Background(), "TestMemoryConnection", Message{Body: []byte("shared")})
+	delivery := receive(t, memoryDeliveries)
+	if string(delivery.Body) != "shared" {
+		t.Errorf("Connections should share queues, received body was '%s'.", string(delivery.Body))
+	}
+	delivery.Ack(false)
+
+	// Closing a connection does not stop the others
+	connection.Close()
+	if connection.Connected() || !memory.Connected() {
+		t.Errorf("Only the closed connection should stop being connected.")
+	}
+	memory.Publish(context.Background(), "TestMemoryConnection", Message{Body: []byte("after close")})
+	if delivery := receive(t, memoryDeliveries); string(delivery.Body) != "after close" {
+		t.Errorf("Consumers of other connections should keep receiving messages, received body was '%s'.", string(delivery.Body))
+	}
+}
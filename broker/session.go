@@ -0,0 +1,496 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/backoff"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/streadway/amqp"
+)
+
+const (
+	DefaultConfirmTimeout = 5 * time.Second
+	DefaultPublishRetries = 3
+)
+
+// Session keeps a RabbitMQ connection and channel with its queues declared, when the connection or the channel
+// are closed Session reconnects using exponential backoff and declares its queues again.
+type Session struct {
+	server   config.Server
+	queues   []string
+	bindings map[string]string
+	prefetch int
+	confirm  bool
+	backoff  *backoff.Backoff
+
+	mutex         sync.Mutex
+	conn          *amqp.Connection
+	channel       *amqp.Channel
+	confirms      chan amqp.Confirmation
+	lost          chan struct{}
+	consumers     []string
+	consumerCount int
+	connected     bool
+	closed        bool
+	reconnections int
+
+	// isOpen is read without locking so Connected does not wait for reconnections
+	isOpen int32
+}
+
+// NewSession creates a Session using RabbitMQ server, prefetch is applied to the channel when it is greater than 0
+func NewSession(server config.Server, prefetch int) *Session {
+	return &Session{
+		server:   server,
+		prefetch: prefetch,
+		backoff:  backoff.New(server.ReconnectInitialDelay, server.ReconnectMaxDelay),
+	}
+}
+
+// NewConfirmSession creates a Session whose channel is in confirm mode, Publish waits until broker confirms each publishing.
+// prefetch is applied like in NewSession.
+func NewConfirmSession(server config.Server, prefetch int) *Session {
+	session := NewSession(server, prefetch)
+	session.confirm = true
+	return session
+}
+
+// DeclareQueue makes session declare a durable queue on every connection, it must be called before using session
+func (s *Session) DeclareQueue(queue string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, declaredQueue := range s.queues {
+		if declaredQueue == queue {
+			return
+		}
+	}
+	s.queues = append(s.queues, queue)
+}
+
+// Bind makes session declare a durable fanout exchange bound to queue on every connection, it must be called before using session
+func (s *Session) Bind(exchange string, queue string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.bindings == nil {
+		s.bindings = make(map[string]string)
+	}
+	s.bindings[exchange] = queue
+}
+
+// Connect connects session if it is not connected yet
+func (s *Session) Connect(ctx context.Context) error {
+	_, err := s.Channel(ctx)
+	return err
+}
+
+// Channel returns session channel, if connection has been lost it reconnects before returning
+func (s *Session) Channel(ctx context.Context) (*amqp.Channel, error) {
+	channel, _, err := s.open(ctx)
+	return channel, err
+}
+
+// open returns session channel and its confirmations, reconnecting if connection has been lost
+func (s *Session) open(ctx context.Context) (*amqp.Channel, chan amqp.Confirmation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, nil, ErrClosed
+	}
+	if s.channel == nil || s.isLost() {
+		if err := s.reconnect(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	return s.channel, s.confirms, nil
+}
+
+// Invalidate marks session channel as lost, next Channel call will reconnect
+func (s *Session) Invalidate(channel *amqp.Channel) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.channel == channel && s.channel != nil && !s.isLost() {
+		close(s.lost)
+	}
+}
+
+// Connected reports whether session connection and channel are open, its queues are declared once they are
+func (s *Session) Connected() bool {
+	return atomic.LoadInt32(&s.isOpen) == 1
+}
+
+// Reconnections returns how many times session has reconnected after losing its connection
+func (s *Session) Reconnections() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.reconnections
+}
+
+// Close closes session connection, session can't be used after closing it
+func (s *Session) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	atomic.StoreInt32(&s.isOpen, 0)
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+func (s *Session) isLost() bool {
+	select {
+	case <-s.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Session) reconnect(ctx context.Context) error {
+	atomic.StoreInt32(&s.isOpen, 0)
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.channel = nil
+		s.confirms = nil
+		s.consumers = nil
+	}
+
+	attempts := 0
+	for {
+		// First connection is tried right away, reconnections always wait
+		if s.connected || attempts > 0 {
+			select {
+			case <-time.After(s.backoff.Next()):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		attempts++
+		err := s.connect()
+		if err == nil {
+			break
+		}
+		if s.server.ReconnectMaxAttempts > 0 && attempts >= s.server.ReconnectMaxAttempts {
+			return fmt.Errorf("Failed to stablish connection with RabbitMQ after %d attempts: %w", attempts, err)
+		}
+	}
+
+	if s.connected {
+		s.reconnections++
+		metrics.Reconnections.Inc()
+	}
+	s.connected = true
+	s.backoff.Reset()
+	return nil
+}
+
+func (s *Session) connect() error {
+	conn, err := Dial(s.server)
+	if err != nil {
+		return fmt.Errorf("Failed to stablish connection with RabbitMQ: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Failed to open RabbitMQ channel: %w", err)
+	}
+
+	if s.prefetch > 0 {
+		err = channel.Qos(
+			s.prefetch, // prefetch count
+			0,          // prefetch size
+			false,      // global
+		)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("Failed to set QoS: %w", err)
+		}
+	}
+
+	for _, queue := range s.queues {
+		_, err = channel.QueueDeclare(
+			queue,
+			true,  // Durable
+			false, // DeleteWhenUnused
+			false, // Exclusive
+			false, // NoWait
+			nil,   // arguments
+		)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("Failed to declare queue %s: %w", queue, err)
+		}
+	}
+
+	for exchange, queue := range s.bindings {
+		err = channel.ExchangeDeclare(
+			exchange,
+			"fanout",
+			true,  // Durable
+			false, // AutoDelete
+			false, // Internal
+			false, // NoWait
+			nil,   // arguments
+		)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("Failed to declare exchange %s: %w", exchange, err)
+		}
+		_, err = channel.QueueDeclare(
+			queue,
+			true,  // Durable
+			false, // DeleteWhenUnused
+			false, // Exclusive
+			false, // NoWait
+			nil,   // arguments
+		)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("Failed to declare queue %s: %w", queue, err)
+		}
+		err = channel.QueueBind(
+			queue,
+			"", // routing key, fanout exchanges ignore it
+			exchange,
+			false, // NoWait
+			nil,   // arguments
+		)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("Failed to bind queue %s to exchange %s: %w", queue, exchange, err)
+		}
+	}
+
+	if s.confirm {
+		err = channel.Confirm(false)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("Failed to put channel in confirm mode: %w", err)
+		}
+		s.confirms = channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	}
+
+	lost := make(chan struct{})
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+	go s.watch(lost, connClosed, channelClosed)
+
+	s.conn = conn
+	s.channel = channel
+	s.lost = lost
+	atomic.StoreInt32(&s.isOpen, 1)
+	return nil
+}
+
+// watch marks connection as lost when connection or channel are closed
+func (s *Session) watch(lost chan struct{}, connClosed chan *amqp.Error, channelClosed chan *amqp.Error) {
+	select {
+	case <-connClosed:
+	case <-channelClosed:
+	}
+	atomic.StoreInt32(&s.isOpen, 0)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	select {
+	case <-lost:
+	default:
+		close(lost)
+	}
+}
+
+// QueueDepth returns how many messages are waiting in queue, unacknowledged deliveries are not counted
+func (s *Session) QueueDepth(ctx context.Context, queue string) (int, error) {
+	channel, err := s.Channel(ctx)
+	if err != nil {
+		return 0, err
+	}
+	state, err := channel.QueueInspect(queue)
+	if err != nil {
+		// Inspecting a queue that does not exist closes channel
+		s.Invalidate(channel)
+		return 0, fmt.Errorf("Failed to inspect queue %s: %w", queue, err)
+	}
+	return state.Messages, nil
+}
+
+// Consume starts consuming queue, deliveries channel is closed when connection is lost so callers must call Consume again.
+// When RabbitMQ refuses the consumer session reconnects and tries again, failed attempts count towards ReconnectMaxAttempts.
+func (s *Session) Consume(ctx context.Context, queue string) (<-chan Delivery, error) {
+	attempts := 0
+	for {
+		channel, err := s.Channel(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		if s.channel != channel {
+			// Session has reconnected meanwhile
+			s.mutex.Unlock()
+			continue
+		}
+		s.consumerCount++
+		consumer := fmt.Sprintf("jobrouter-%s-%d", queue, s.consumerCount)
+		lost := s.lost
+		s.mutex.Unlock()
+
+		deliveries, err := channel.Consume(
+			queue,
+			consumer,
+			false, // auto-ack
+			false, // exclusive
+			false, // no-local
+			false, // no-wait
+			nil,   // args
+		)
+		if err == nil {
+			s.mutex.Lock()
+			if s.channel == channel {
+				s.consumers = append(s.consumers, consumer)
+			}
+			s.mutex.Unlock()
+			return toDeliveries(deliveries, lost), nil
+		}
+		// Refused consumers close the channel, for example when queue does not exist or access is refused
+		s.Invalidate(channel)
+		attempts++
+		if s.server.ReconnectMaxAttempts > 0 && attempts >= s.server.ReconnectMaxAttempts {
+			return nil, fmt.Errorf("Failed to consume queue %s after %d attempts: %w", queue, attempts, err)
+		}
+	}
+}
+
+// toDeliveries converts amqp deliveries, returned channel is closed when amqp one is closed.
+// lost is closed once the channel deliveries come from is closed.
+func toDeliveries(amqpDeliveries <-chan amqp.Delivery, lost <-chan struct{}) <-chan Delivery {
+	deliveries := make(chan Delivery)
+	go func() {
+		defer close(deliveries)
+		for delivery := range amqpDeliveries {
+			deliveries <- Delivery{Message: Message{Body: delivery.Body, Headers: delivery.Headers}, acknowledger: delivery, lost: lost}
+		}
+	}()
+	return deliveries
+}
+
+// Cancel stops session consumers, the channel is kept open so received deliveries can still be acknowledged
+func (s *Session) Cancel() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.channel == nil || s.isLost() {
+		return
+	}
+	for _, consumer := range s.consumers {
+		s.channel.Cancel(consumer, false)
+	}
+	s.consumers = nil
+}
+
+// Publish sends message to queue as a persistent publishing, if connection is lost it is held until session reconnects.
+// On confirm sessions message is sent again when broker nacks it or its confirmation times out.
+func (s *Session) Publish(ctx context.Context, queue string, message Message) error {
+	return s.PublishToExchange(ctx, "", queue, message)
+}
+
+// PublishToExchange sends message to exchange using routingKey, it behaves like Publish
+func (s *Session) PublishToExchange(ctx context.Context, exchange string, routingKey string, message Message) error {
+	publishing := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  "text/plain",
+		Headers:      amqp.Table(message.Headers),
+		Body:         message.Body,
+	}
+	publishRetries := 0
+	for {
+		channel, confirms, err := s.open(ctx)
+		if err != nil {
+			return err
+		}
+		err = channel.Publish(
+			exchange,
+			routingKey,
+			false, // mandatory
+			false, // immediate
+			publishing)
+		if err != nil {
+			s.Invalidate(channel)
+			continue
+		}
+		if !s.confirm {
+			return nil
+		}
+
+		confirmed, err := s.waitConfirmation(ctx, channel, confirms)
+		if confirmed {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			// Connection was lost before confirmation arrived
+			continue
+		}
+		publishRetries++
+		if publishRetries > s.publishRetries() {
+			return fmt.Errorf("Failed to publish to %s after %d attempts: %w", publishingTarget(exchange, routingKey), publishRetries, err)
+		}
+	}
+}
+
+func publishingTarget(exchange string, routingKey string) string {
+	if exchange == "" {
+		return "queue " + routingKey
+	}
+	return "exchange " + exchange
+}
+
+// waitConfirmation waits for publishing confirmation, it returns no error when connection has been lost
+func (s *Session) waitConfirmation(ctx context.Context, channel *amqp.Channel, confirms chan amqp.Confirmation) (bool, error) {
+	timeout := s.server.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case confirmation, ok := <-confirms:
+		if !ok {
+			s.Invalidate(channel)
+			return false, nil
+		}
+		if confirmation.Ack {
+			return true, nil
+		}
+		return false, ErrNacked
+	case <-timer.C:
+		// A late confirmation would be taken as the next publishing one, a new channel is required
+		s.Invalidate(channel)
+		return false, ErrConfirmTimeout
+	case <-ctx.Done():
+		s.Invalidate(channel)
+		return false, ctx.Err()
+	}
+}
+
+func (s *Session) publishRetries() int {
+	if s.server.PublishRetries <= 0 {
+		return DefaultPublishRetries
+	}
+	return s.server.PublishRetries
+}
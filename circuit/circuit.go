@@ -0,0 +1,135 @@
+package circuit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/retry"
+)
+
+const (
+	DefaultThreshold   = 5
+	DefaultOpenTimeout = 30 * time.Second
+)
+
+// ErrOpen is returned without calling the service while the breaker is open
+var ErrOpen = errors.New("Circuit breaker is open.")
+
+// State of a Breaker
+type State int
+
+const (
+	// Closed breakers let every call through
+	Closed State = iota
+	// Open breakers reject every call until their timeout expires
+	Open
+	// HalfOpen breakers let one trial call through, its result closes or opens the breaker again
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Protected is implemented by clients whose calls go through a Breaker
+type Protected interface {
+	Breaker() *Breaker
+}
+
+// Breaker stops calling a service after threshold consecutive failures, once openTimeout has passed one trial call is allowed.
+// Permanent errors mean service is answering so they are not counted as failures.
+type Breaker struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mutex    sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trying   bool
+}
+
+// New creates a closed Breaker, zero values mean default ones
+func New(threshold int, openTimeout time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	if openTimeout <= 0 {
+		openTimeout = DefaultOpenTimeout
+	}
+	return &Breaker{threshold: threshold, openTimeout: openTimeout, now: time.Now}
+}
+
+// State returns breaker state, open breakers whose timeout has expired are reported as half-open
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Call runs call unless breaker is open, ErrOpen is returned as a permanent error so it is not retried
+func (b *Breaker) Call(ctx context.Context, call func(ctx context.Context) error) error {
+	if !b.allow() {
+		return retry.Permanent(ErrOpen)
+	}
+	err := call(ctx)
+	b.record(err)
+	return err
+}
+
+func (b *Breaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case Closed:
+		return true
+	case Open:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = HalfOpen
+	}
+	// Only one trial call is allowed while half-open
+	if b.trying {
+		return false
+	}
+	b.trying = true
+	return true
+}
+
+func (b *Breaker) record(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trying = false
+	if errors.Is(err, context.Canceled) {
+		// Call was abandoned, it says nothing about service health
+		return
+	}
+	if err == nil || retry.IsPermanent(err) {
+		b.state = Closed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state = Open
+		b.openedAt = b.now()
+	}
+}
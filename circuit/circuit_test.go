@@ -0,0 +1,129 @@
+// +build integration_tests unit_tests
+
+package circuit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/retry"
+)
+
+var errUnavailable = errors.New("Service unavailable.")
+
+func failingCall(ctx context.Context) error {
+	return errUnavailable
+}
+
+func succeedingCall(ctx context.Context) error {
+	return nil
+}
+
+// testBreaker returns a breaker whose clock is moved forward with advance
+func testBreaker(threshold int) (*Breaker, func(time.Duration)) {
+	now := time.Now()
+	breaker := New(threshold, time.Minute)
+	breaker.now = func() time.Time { return now }
+	return breaker, func(elapsed time.Duration) { now = now.Add(elapsed) }
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+
+	breaker, _ := testBreaker(2)
+
+	breaker.Call(context.Background(), failingCall)
+	if breaker.State() != Closed {
+		t.Errorf("Breaker should be closed after one failure, state is %s.", breaker.State())
+	}
+	breaker.Call(context.Background(), failingCall)
+	if breaker.State() != Open {
+		t.Errorf("Breaker should be open after two failures, state is %s.", breaker.State())
+	}
+
+	called := false
+	err := breaker.Call(context.Background(), func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if called {
+		t.Errorf("Open breaker should not make calls.")
+	}
+	if !errors.Is(err, ErrOpen) || !retry.IsPermanent(err) {
+		t.Errorf("Open breaker should return a permanent ErrOpen.")
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+
+	breaker, _ := testBreaker(2)
+
+	breaker.Call(context.Background(), failingCall)
+	breaker.Call(context.Background(), succeedingCall)
+	breaker.Call(context.Background(), failingCall)
+	if breaker.State() != Closed {
+		t.Errorf("Failures should be consecutive to open breaker, state is %s.", breaker.State())
+	}
+}
+
+func TestBreakerIgnoresPermanentErrors(t *testing.T) {
+
+	breaker, _ := testBreaker(1)
+
+	breaker.Call(context.Background(), func(ctx context.Context) error {
+		return retry.Permanent(errors.New("Bad request."))
+	})
+	if breaker.State() != Closed {
+		t.Errorf("Permanent errors should not open breaker, state is %s.", breaker.State())
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+
+	breaker, advance := testBreaker(1)
+
+	breaker.Call(context.Background(), failingCall)
+	advance(time.Minute)
+	if breaker.State() != HalfOpen {
+		t.Errorf("Breaker should be half-open once timeout has expired, state is %s.", breaker.State())
+	}
+
+	// Trial call fails so breaker opens again
+	breaker.Call(context.Background(), failingCall)
+	if breaker.State() != Open {
+		t.Errorf("Breaker should open again when trial call fails, state is %s.", breaker.State())
+	}
+
+	advance(time.Minute)
+	err := breaker.Call(context.Background(), succeedingCall)
+	if err != nil {
+		t.Errorf("Trial call should be made when breaker is half-open.")
+	}
+	if breaker.State() != Closed {
+		t.Errorf("Breaker should close when trial call succeeds, state is %s.", breaker.State())
+	}
+}
+
+func TestBreakerAllowsOneTrialCall(t *testing.T) {
+
+	breaker, advance := testBreaker(1)
+
+	breaker.Call(context.Background(), failingCall)
+	advance(time.Minute)
+
+	trialStarted := make(chan struct{})
+	finishTrial := make(chan struct{})
+	go breaker.Call(context.Background(), func(ctx context.Context) error {
+		close(trialStarted)
+		<-finishTrial
+		return nil
+	})
+	<-trialStarted
+
+	err := breaker.Call(context.Background(), succeedingCall)
+	if !errors.Is(err, ErrOpen) {
+		t.Errorf("Only one trial call should be made while breaker is half-open.")
+	}
+	close(finishTrial)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	viperLib "github.com/spf13/viper"
+)
+
+// EnvironmentPrefix is prepended to every config key to get the environment variable that overrides it,
+// dots are replaced by underscores so server.host is overridden by MUSIC_MANAGER_SERVER_HOST
+const EnvironmentPrefix = "MUSIC_MANAGER"
+
+// configFileLocationVariable sets the folder where config.toml is searched
+const configFileLocationVariable = "MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION"
+
+// useEnvironment makes viper take every key from its environment variable when it is set
+func useEnvironment(viper *viperLib.Viper) {
+	viper.SetEnvPrefix(EnvironmentPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+}
+
+// environmentVariable returns the environment variable that overrides key
+func environmentVariable(key string) string {
+	return EnvironmentPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// environmentKeys returns sorted lowercase keys set through environment variables under section,
+// MUSIC_MANAGER_WRAPPERS_FIRSTWRAPPER_ORDER is returned as "firstwrapper_order" for section "wrappers"
+func environmentKeys(section string) []string {
+	prefix := EnvironmentPrefix + "_" + strings.ToUpper(section) + "_"
+	var keys []string
+	for _, variable := range os.Environ() {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			keys = append(keys, strings.ToLower(strings.TrimPrefix(name, prefix)))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hasEnvironmentConfig reports whether any setting is defined through environment variables
+func hasEnvironmentConfig() bool {
+	for _, variable := range os.Environ() {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if strings.HasPrefix(name, EnvironmentPrefix+"_") && name != configFileLocationVariable {
+			return true
+		}
+	}
+	return false
+}
+
+// sectionIsSet reports whether section is defined in config file or through environment variables
+func sectionIsSet(viper *viperLib.Viper, section string) bool {
+	return viper.IsSet(section) || len(environmentKeys(section)) > 0
+}
+
+// sectionKeys returns sorted keys of section defined in config file or through environment variables,
+// suffixes are removed from environment keys so "firstwrapper_order" is returned as "firstwrapper" when suffixes contain "_order"
+func sectionKeys(viper *viperLib.Viper, section string, suffixes ...string) []string {
+	keySet := make(map[string]bool)
+	if fileKeys, ok := viper.Get(section).(map[string]interface{}); ok {
+		for key := range fileKeys {
+			keySet[key] = true
+		}
+	}
+	for _, key := range environmentKeys(section) {
+		if len(suffixes) == 0 {
+			keySet[key] = true
+			continue
+		}
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(key, suffix) && len(key) > len(suffix) {
+				keySet[strings.TrimSuffix(key, suffix)] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getList returns key as a list, lists coming from environment variables are separated by commas or spaces
+func getList(viper *viperLib.Viper, key string) []string {
+	if value, ok := viper.Get(key).(string); ok {
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return viper.GetStringSlice(key)
+}
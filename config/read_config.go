@@ -2,46 +2,203 @@ package config
 
 import (
 	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
 	viperLib "github.com/spf13/viper"
 )
 
+// Server is the message broker, memory brokers keep jobs inside JobRouter so they do not use any other setting
 type Server struct {
-	User     string
-	Password string
-	Host     string
-	Port     int
+	Type                  string
+	User                  string
+	Password              string
+	Host                  string
+	Port                  int
+	ReconnectInitialDelay time.Duration
+	ReconnectMaxDelay     time.Duration
+	ReconnectMaxAttempts  int
+	ConfirmTimeout        time.Duration
+	PublishRetries        int
+	// TLS makes JobRouter connect using amqps, CAFile replaces system CAs and CertFile and KeyFile are a client certificate
+	TLS      bool
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// VHost, Heartbeat, ConnectionName and Locale are sent when connection is opened, zero values mean default ones
+	VHost          string
+	Heartbeat      time.Duration
+	ConnectionName string
+	Locale         string
 }
 
 type Queue struct {
 	Name string
 }
 
+type DeadLetter struct {
+	Exchange string
+	Queue    string
+}
+
+// Outbox is the local directory where status and storage notifications are kept until they are delivered
+type Outbox struct {
+	Directory     string
+	RetryInterval time.Duration
+}
+
+// HTTP is the address where JobRouter serves its http endpoints like /metrics.
+// LivenessTimeout is how long a loop can be busy with the same job before /healthz fails, zero means default timeout.
+type HTTP struct {
+	Address         string
+	LivenessTimeout time.Duration
+}
+
+// Admin enables admin API on http server, Token authenticates its requests.
+// RecentDecisions is how many routing decisions it keeps, zero means default size.
+type Admin struct {
+	Token           string
+	RecentDecisions int
+}
+
+// Log formats
+const (
+	LogfmtFormat = "logfmt"
+	JSONFormat   = "json"
+)
+
+// LogLevels are the levels JobRouter can log with, from the most to the least verbose
+var LogLevels = []string{"debug", "info", "warn", "error"}
+
+// Log decides how JobRouter logs, messages below Level are discarded
+type Log struct {
+	Level  string
+	Format string
+}
+
+// Tracing exporters
+const (
+	OTLPExporter = "otlp"
+	FileExporter = "file"
+)
+
+// Tracing decides where spans are exported, Endpoint and Insecure are only used by otlp exporter and File by file one.
+// SampleRatio is the fraction of traces started by JobRouter that are sampled, traces started upstream keep their sampling decision.
+type Tracing struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	File        string
+	SampleRatio float64
+}
+
+// Broker types, they decide where jobs are read from and sent to
+const (
+	RabbitMQBroker = "rabbitmq"
+	MemoryBroker   = "memory"
+)
+
+// Service types, they decide how jobs are sent to status and storage services
+const (
+	HTTPService = "http"
+	NoopService = "noop"
+	LogService  = "log"
+	FileService = "file"
+)
+
+// Service is a downstream service finished jobs are sent to, Name, URL, credentials and TLS files are only used by http services and File by file ones.
+// Failed http calls are retried and a circuit breaker stops calling the service while it keeps failing.
+type Service struct {
+	Type string
+	Name string
+	// URL overrides Name, it may include scheme, port and path
+	URL string
+	// Token is sent as a bearer token, Username and Password are sent using basic auth
+	Token    string
+	Username string
+	Password string
+	// CAFile is a PEM bundle used instead of system CAs, CertFile and KeyFile are a client certificate for mutual TLS
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// HTTP client settings, zero values mean default ones and an empty Proxy means proxy is taken from environment
+	Timeout            time.Duration
+	MaxIdleConnections int
+	KeepAlive          time.Duration
+	Proxy              string
+	File               string
+	Retries            int
+	RetryInitialDelay  time.Duration
+	RetryMaxDelay      time.Duration
+	BreakerThreshold   int
+	BreakerTimeout     time.Duration
+}
+
+// Endpoint returns the URL jobs are posted to, services defined only by name are called through http
+func (s Service) Endpoint() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	return "http://" + s.Name
+}
+
+// JobTypes maps job type names used in routes config to job types
+var JobTypes = map[string]commontypes.JobType{
+	"artistinforetrieval": commontypes.ArtistInfoRetrieval,
+	"recordinforetrieval": commontypes.RecordInfoRetrieval,
+	"jobinforetrieval":    commontypes.JobInfoRetrieval,
+}
+
+// JobTypeName returns the name used in config for jobType
+func JobTypeName(jobType commontypes.JobType) string {
+	for name, configJobType := range JobTypes {
+		if configJobType == jobType {
+			return name
+		}
+	}
+	return "unknown"
+}
+
 type Config struct {
 	Server        Server
 	Wrappers      []Queue
-	Status        string
-	Storage       string
+	Routes        map[commontypes.JobType][]string
+	Status        Service
+	Storage       Service
 	JobManager    Queue
 	WrapperOutput Queue
+	DeadLetter    DeadLetter
+	Outbox        Outbox
+	HTTP          HTTP
+	Admin         Admin
+	Log           Log
+	Tracing       Tracing
+	// ShutdownGracePeriod is the maximum time JobRouter waits for in flight jobs when it is stopped
+	ShutdownGracePeriod time.Duration
 }
 
+// ReadConfig reads config.toml from MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION folder, /etc/music-manager/ by default.
+// Every key can be overridden by an environment variable named after it with EnvironmentPrefix, so environment variables
+// take precedence over config file and config file over default values. Config file is optional when settings are defined in environment.
 func ReadConfig() (Config, error) {
 	var configFileLocation string
 	var config Config
 
-	var envVariable string = "MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION"
-
-	serverVariables := []string{"host", "port", "user", "password"}
 	queueVariables := []string{"name"}
+	wrapperVariables := []string{"name", "order"}
 
 	requiredConfigEntities := []string{"wrappers", "status", "storage", "jobmanager", "wrapperoutput"}
 
 	viper := viperLib.New()
 
 	//Look for config file location defined as env var
-	viper.BindEnv(envVariable)
-	configFileLocation = viper.GetString(envVariable)
+	viper.BindEnv(configFileLocationVariable)
+	configFileLocation = viper.GetString(configFileLocationVariable)
 	if configFileLocation == "" {
 		// Get config file from default location
 		configFileLocation = "/etc/music-manager/"
@@ -50,45 +207,99 @@ func ReadConfig() (Config, error) {
 	viper.SetConfigType("toml")
 	viper.AddConfigPath(configFileLocation)
 
+	// Every setting can be overridden by environment variables, config file is not required when settings are defined that way
+	useEnvironment(viper)
 	if err := viper.ReadInConfig(); err != nil {
-		return config, errors.New(errors.New("Fatal error reading config file: ").Error() + err.Error())
-	}
-
-	for _, server_variable := range serverVariables {
-		if !viper.IsSet("server." + server_variable) {
-			return config, errors.New("Fatal error reading config: no server " + server_variable + " was found.")
+		if _, notFound := err.(viperLib.ConfigFileNotFoundError); !notFound || !hasEnvironmentConfig() {
+			return config, errors.New(errors.New("Fatal error reading config file: ").Error() + err.Error())
 		}
 	}
 
-	server := Server{User: viper.GetString("server.user"), Password: viper.GetString("server.password"), Host: viper.GetString("server.host"), Port: viper.GetInt("server.port")}
-
+	server, err := readServer(viper)
+	if err != nil {
+		return config, err
+	}
 	config.Server = server
 
 	for _, requiredConfigEntity := range requiredConfigEntities {
-		if !viper.IsSet(requiredConfigEntity) {
+		if !sectionIsSet(viper, requiredConfigEntity) {
 			return config, errors.New("Fatal error reading config: no " + requiredConfigEntity + " config was found.")
 		}
 	}
 
 	// Check Wrappers
 
-	wrapperConfig := viper.Get("wrappers")
-	wrapperConfigElementsMap := wrapperConfig.(map[string]interface{})
-
-	if len(wrapperConfigElementsMap) == 0 {
+	// Wrappers are sorted by name so validation errors are reproducible
+	wrapperNames := sectionKeys(viper, "wrappers", "_name", "_order")
+	if len(wrapperNames) == 0 {
 		return config, errors.New("Fatal error reading config: no wrappers were found, at least one wrapper must be defined.")
 	}
+	definedWrappers := make(map[string]bool)
+	for _, wrapperName := range wrapperNames {
+		definedWrappers[wrapperName] = true
+	}
 
-	for wrapperName, _ := range wrapperConfigElementsMap {
-		for _, requiredQueueVeriable := range queueVariables {
-			if !viper.IsSet("wrappers." + wrapperName + "." + requiredQueueVeriable) {
-				return config, errors.New("Fatal error reading config: wrapper " + wrapperName + " has an invalid config: " + requiredQueueVeriable + " is not defined.")
+	wrappersByOrder := make(map[int]string)
+	for _, wrapperName := range wrapperNames {
+		for _, requiredWrapperVeriable := range wrapperVariables {
+			if !viper.IsSet("wrappers." + wrapperName + "." + requiredWrapperVeriable) {
+				return config, errors.New("Fatal error reading config: wrapper " + wrapperName + " has an invalid config: " + requiredWrapperVeriable + " is not defined.")
 			}
 		}
+		wrapperOrder := viper.GetInt("wrappers." + wrapperName + ".order")
+		if wrapperOrder < 1 {
+			return config, errors.New("Fatal error reading config: wrapper " + wrapperName + " has an invalid config: order must be greater than 0.")
+		}
+		if otherWrapperName, duplicated := wrappersByOrder[wrapperOrder]; duplicated {
+			return config, errors.New("Fatal error reading config: wrappers " + otherWrapperName + " and " + wrapperName + " have the same order " + strconv.Itoa(wrapperOrder) + ".")
+		}
+		wrappersByOrder[wrapperOrder] = wrapperName
+	}
+
+	// Orders must go from 1 to the number of wrappers without gaps, that is the fallback chain used by RouteJobs
+	for order := 1; order <= len(wrapperNames); order++ {
+		wrapperName, ok := wrappersByOrder[order]
+		if !ok {
+			return config, errors.New("Fatal error reading config: wrapper orders must be consecutive starting from 1, order " + strconv.Itoa(order) + " is not defined.")
+		}
 		wrapperConfig := Queue{Name: viper.GetString("wrappers." + wrapperName + ".name")}
 		config.Wrappers = append(config.Wrappers, wrapperConfig)
 	}
 
+	// Check Routes, they are optional, without routes every job type uses wrappers order
+	if sectionIsSet(viper, "routes") {
+		routeNames := sectionKeys(viper, "routes")
+		if len(routeNames) == 0 {
+			return config, errors.New("Fatal error reading config: routes has an invalid config: at least one route must be defined.")
+		}
+
+		config.Routes = make(map[commontypes.JobType][]string)
+		for _, routeName := range routeNames {
+			jobType, ok := JobTypes[routeName]
+			if !ok {
+				return config, errors.New("Fatal error reading config: route " + routeName + " is not a valid job type.")
+			}
+			routeWrappers := getList(viper, "routes."+routeName)
+			if len(routeWrappers) == 0 {
+				return config, errors.New("Fatal error reading config: route " + routeName + " has no wrappers.")
+			}
+			routeQueues := make(map[string]bool)
+			for _, routeWrapper := range routeWrappers {
+				// Viper keys are case insensitive
+				routeWrapper = strings.ToLower(routeWrapper)
+				if !definedWrappers[routeWrapper] {
+					return config, errors.New("Fatal error reading config: route " + routeName + " uses wrapper " + routeWrapper + " which is not defined.")
+				}
+				queueName := viper.GetString("wrappers." + routeWrapper + ".name")
+				if routeQueues[queueName] {
+					return config, errors.New("Fatal error reading config: route " + routeName + " uses wrapper " + routeWrapper + " more than once.")
+				}
+				routeQueues[queueName] = true
+				config.Routes[jobType] = append(config.Routes[jobType], queueName)
+			}
+		}
+	}
+
 	// Check JobManager
 	for _, requiredQueueVeriable := range queueVariables {
 		if !viper.IsSet("jobmanager." + requiredQueueVeriable) {
@@ -107,17 +318,332 @@ func ReadConfig() (Config, error) {
 	wrapperoutputConfig := Queue{Name: viper.GetString("wrapperoutput.name")}
 	config.WrapperOutput = wrapperoutputConfig
 
+	// Check DeadLetter, it is optional and uses default names when they are not defined
+	config.DeadLetter = DeadLetter{Exchange: "deadletter", Queue: "deadletter"}
+	if viper.IsSet("deadletter.exchange") {
+		config.DeadLetter.Exchange = viper.GetString("deadletter.exchange")
+	}
+	if viper.IsSet("deadletter.queue") {
+		config.DeadLetter.Queue = viper.GetString("deadletter.queue")
+	}
+	if config.DeadLetter.Exchange == "" || config.DeadLetter.Queue == "" {
+		return config, errors.New("Fatal error reading config: deadletter has an invalid config: exchange and queue can't be empty.")
+	}
+
+	// Check Outbox, it is optional, without it notifications are sent straight to status and storage services
+	if sectionIsSet(viper, "outbox") {
+		if !viper.IsSet("outbox.directory") || viper.GetString("outbox.directory") == "" {
+			return config, errors.New("Fatal error reading config: outbox has an invalid config: directory is not defined.")
+		}
+		config.Outbox.Directory = viper.GetString("outbox.directory")
+		config.Outbox.RetryInterval = viper.GetDuration("outbox.retry_interval")
+		if config.Outbox.RetryInterval < 0 {
+			return config, errors.New("Fatal error reading config: outbox has an invalid config: retry_interval can't be negative.")
+		}
+	}
+
+	// Check HTTP, it is optional, without it no http endpoints are served
+	if sectionIsSet(viper, "http") {
+		config.HTTP.Address = viper.GetString("http.address")
+		if _, _, err := net.SplitHostPort(config.HTTP.Address); err != nil {
+			return config, errors.New("Fatal error reading config: http has an invalid config: address '" + config.HTTP.Address + "' is not valid.")
+		}
+		config.HTTP.LivenessTimeout = viper.GetDuration("http.liveness_timeout")
+		if config.HTTP.LivenessTimeout < 0 {
+			return config, errors.New("Fatal error reading config: http has an invalid config: liveness_timeout can't be negative.")
+		}
+	}
+
+	// Check Admin, it is optional and it is served by http server
+	if sectionIsSet(viper, "admin") {
+		if config.HTTP.Address == "" {
+			return config, errors.New("Fatal error reading config: admin has an invalid config: http section is not defined.")
+		}
+		if !secretIsSet(viper, "admin.token") {
+			return config, errors.New("Fatal error reading config: admin has an invalid config: token is not defined.")
+		}
+		config.Admin.Token, err = readSecret(viper, "admin.token")
+		if err != nil {
+			return config, errors.New("Fatal error reading config: admin has an invalid config: " + err.Error())
+		}
+		if config.Admin.Token == "" {
+			return config, errors.New("Fatal error reading config: admin has an invalid config: token can't be empty.")
+		}
+		config.Admin.RecentDecisions = viper.GetInt("admin.recent_decisions")
+		if config.Admin.RecentDecisions < 0 {
+			return config, errors.New("Fatal error reading config: admin has an invalid config: recent_decisions can't be negative.")
+		}
+	}
+
+	// Check Log, it is optional
+	config.Log = Log{Level: "info", Format: LogfmtFormat}
+	if viper.IsSet("log.level") {
+		config.Log.Level = viper.GetString("log.level")
+		if !isLogLevel(config.Log.Level) {
+			return config, errors.New("Fatal error reading config: log has an invalid config: level '" + config.Log.Level + "' is not valid.")
+		}
+	}
+	if viper.IsSet("log.format") {
+		config.Log.Format = viper.GetString("log.format")
+		if config.Log.Format != LogfmtFormat && config.Log.Format != JSONFormat {
+			return config, errors.New("Fatal error reading config: log has an invalid config: format '" + config.Log.Format + "' is not valid.")
+		}
+	}
+
+	// Check Tracing, it is optional, without it spans are not exported but trace context is still propagated
+	if sectionIsSet(viper, "tracing") {
+		config.Tracing, err = readTracing(viper)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	// Check Shutdown, it is optional
+	config.ShutdownGracePeriod = 30 * time.Second
+	if viper.IsSet("shutdown.grace_period") {
+		config.ShutdownGracePeriod = viper.GetDuration("shutdown.grace_period")
+		if config.ShutdownGracePeriod <= 0 {
+			return config, errors.New("Fatal error reading config: shutdown has an invalid config: grace_period must be greater than 0.")
+		}
+	}
+
 	// Check Status
-	if !viper.IsSet("status.name") {
-		return config, errors.New("Fatal error reading config: status has an invalid config: name is not defined.")
+	config.Status, err = readService(viper, "status")
+	if err != nil {
+		return config, err
 	}
-	config.Status = viper.GetString("status.name")
 
 	// Check Storage
-	if !viper.IsSet("storage.name") {
-		return config, errors.New("Fatal error reading config: storage has an invalid config: name is not defined.")
+	config.Storage, err = readService(viper, "storage")
+	if err != nil {
+		return config, err
 	}
-	config.Storage = viper.GetString("storage.name")
 
 	return config, nil
 }
+
+// readServer reads server section, rabbitmq is used when no type is defined
+func readServer(viper *viperLib.Viper) (Server, error) {
+	server := Server{Type: RabbitMQBroker}
+	if viper.IsSet("server.type") {
+		server.Type = viper.GetString("server.type")
+	}
+	switch server.Type {
+	case MemoryBroker:
+		// Jobs never leave JobRouter, there is nothing to connect to
+		return server, nil
+	case RabbitMQBroker:
+	default:
+		return server, errors.New("Fatal error reading config: server has an invalid config: type '" + server.Type + "' is not valid.")
+	}
+
+	serverVariables := []string{"host", "port", "user", "password"}
+	for _, server_variable := range serverVariables {
+		if !secretIsSet(viper, "server."+server_variable) {
+			return server, errors.New("Fatal error reading config: no server " + server_variable + " was found.")
+		}
+	}
+
+	server.Host = viper.GetString("server.host")
+	server.Port = viper.GetInt("server.port")
+
+	// Credentials may be taken from environment variables or secret files
+	var err error
+	server.User, err = readSecret(viper, "server.user")
+	if err == nil {
+		server.Password, err = readSecret(viper, "server.password")
+	}
+	if err != nil {
+		return server, errors.New("Fatal error reading config: server has an invalid config: " + err.Error())
+	}
+
+	// Reconnection settings are optional, zero values mean default delays and unlimited attempts
+	server.ReconnectInitialDelay = viper.GetDuration("server.reconnect_initial_delay")
+	server.ReconnectMaxDelay = viper.GetDuration("server.reconnect_max_delay")
+	server.ReconnectMaxAttempts = viper.GetInt("server.reconnect_max_attempts")
+	if server.ReconnectInitialDelay < 0 || server.ReconnectMaxDelay < 0 || server.ReconnectMaxAttempts < 0 {
+		return server, errors.New("Fatal error reading config: server reconnection settings can't be negative.")
+	}
+
+	// Publishing settings are optional too, zero values mean default ones
+	server.ConfirmTimeout = viper.GetDuration("server.confirm_timeout")
+	server.PublishRetries = viper.GetInt("server.publish_retries")
+	if server.ConfirmTimeout < 0 || server.PublishRetries < 0 {
+		return server, errors.New("Fatal error reading config: server publishing settings can't be negative.")
+	}
+
+	// Connection settings are optional too
+	server.TLS = viper.GetBool("server.tls")
+	server.CAFile = viper.GetString("server.ca_file")
+	server.CertFile = viper.GetString("server.cert_file")
+	server.KeyFile = viper.GetString("server.key_file")
+	server.VHost = viper.GetString("server.vhost")
+	server.Heartbeat = viper.GetDuration("server.heartbeat")
+	server.ConnectionName = viper.GetString("server.connection_name")
+	server.Locale = viper.GetString("server.locale")
+	if err := validateServerConnection(server); err != nil {
+		return server, errors.New("Fatal error reading config: server has an invalid config: " + err.Error())
+	}
+
+	return server, nil
+}
+
+// validateServerConnection checks server TLS files exist and can be used together
+func validateServerConnection(server Server) error {
+	if server.Heartbeat < 0 {
+		return errors.New("heartbeat can't be negative.")
+	}
+	if (server.CertFile == "") != (server.KeyFile == "") {
+		return errors.New("cert_file and key_file must be defined together.")
+	}
+	if (server.CAFile != "" || server.CertFile != "") && !server.TLS {
+		return errors.New("ca_file, cert_file and key_file require tls.")
+	}
+	for _, file := range []string{server.CAFile, server.CertFile, server.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			return errors.New("file '" + file + "' can't be read.")
+		}
+	}
+	return nil
+}
+
+// readTracing reads tracing section, otlp exporter is used when no exporter is defined
+func readTracing(viper *viperLib.Viper) (Tracing, error) {
+	tracing := Tracing{Exporter: OTLPExporter, SampleRatio: 1}
+	if viper.IsSet("tracing.exporter") {
+		tracing.Exporter = viper.GetString("tracing.exporter")
+	}
+	switch tracing.Exporter {
+	case OTLPExporter:
+		tracing.Endpoint = viper.GetString("tracing.endpoint")
+		if tracing.Endpoint != "" {
+			if _, _, err := net.SplitHostPort(tracing.Endpoint); err != nil {
+				return tracing, errors.New("Fatal error reading config: tracing has an invalid config: endpoint '" + tracing.Endpoint + "' is not valid.")
+			}
+		}
+		tracing.Insecure = viper.GetBool("tracing.insecure")
+	case FileExporter:
+		if !viper.IsSet("tracing.file") {
+			return tracing, errors.New("Fatal error reading config: tracing has an invalid config: file is not defined.")
+		}
+		tracing.File = viper.GetString("tracing.file")
+	default:
+		return tracing, errors.New("Fatal error reading config: tracing has an invalid config: exporter '" + tracing.Exporter + "' is not valid.")
+	}
+	if viper.IsSet("tracing.sample_ratio") {
+		tracing.SampleRatio = viper.GetFloat64("tracing.sample_ratio")
+		if tracing.SampleRatio < 0 || tracing.SampleRatio > 1 {
+			return tracing, errors.New("Fatal error reading config: tracing has an invalid config: sample_ratio must be between 0 and 1.")
+		}
+	}
+	return tracing, nil
+}
+
+// isLogLevel checks level is one of LogLevels
+func isLogLevel(level string) bool {
+	for _, logLevel := range LogLevels {
+		if level == logLevel {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHTTPService checks http service URL, client settings, credentials and TLS files can be used together
+func validateHTTPService(service Service) error {
+	serviceURL, err := url.Parse(service.Endpoint())
+	if err != nil || (serviceURL.Scheme != "http" && serviceURL.Scheme != "https") || serviceURL.Host == "" {
+		return errors.New("url '" + service.Endpoint() + "' is not valid.")
+	}
+	if service.Token != "" && (service.Username != "" || service.Password != "") {
+		return errors.New("token and basic auth credentials can't be used together.")
+	}
+	if service.Timeout < 0 || service.MaxIdleConnections < 0 || service.KeepAlive < 0 {
+		return errors.New("http client settings can't be negative.")
+	}
+	if service.Proxy != "" {
+		proxyURL, err := url.Parse(service.Proxy)
+		if err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5") || proxyURL.Host == "" {
+			return errors.New("proxy '" + service.Proxy + "' is not valid.")
+		}
+	}
+	if service.Password != "" && service.Username == "" {
+		return errors.New("username is not defined.")
+	}
+	if (service.CertFile == "") != (service.KeyFile == "") {
+		return errors.New("cert_file and key_file must be defined together.")
+	}
+	if (service.CAFile != "" || service.CertFile != "") && serviceURL.Scheme != "https" {
+		return errors.New("ca_file, cert_file and key_file require an https url.")
+	}
+	for _, file := range []string{service.CAFile, service.CertFile, service.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			return errors.New("file '" + file + "' can't be read.")
+		}
+	}
+	return nil
+}
+
+// readService reads status or storage service config, type is "http" by default
+func readService(viper *viperLib.Viper, serviceName string) (Service, error) {
+	service := Service{Type: HTTPService}
+	if viper.IsSet(serviceName + ".type") {
+		service.Type = viper.GetString(serviceName + ".type")
+	}
+
+	switch service.Type {
+	case HTTPService:
+		if !viper.IsSet(serviceName+".name") && !viper.IsSet(serviceName+".url") {
+			return service, errors.New("Fatal error reading config: " + serviceName + " has an invalid config: name is not defined.")
+		}
+		service.Name = viper.GetString(serviceName + ".name")
+		service.URL = viper.GetString(serviceName + ".url")
+		// Credentials may be taken from environment variables or secret files
+		var err error
+		service.Token, err = readSecret(viper, serviceName+".token")
+		if err == nil {
+			service.Username, err = readSecret(viper, serviceName+".username")
+		}
+		if err == nil {
+			service.Password, err = readSecret(viper, serviceName+".password")
+		}
+		if err != nil {
+			return service, errors.New("Fatal error reading config: " + serviceName + " has an invalid config: " + err.Error())
+		}
+		service.CAFile = viper.GetString(serviceName + ".ca_file")
+		service.CertFile = viper.GetString(serviceName + ".cert_file")
+		service.KeyFile = viper.GetString(serviceName + ".key_file")
+		service.Timeout = viper.GetDuration(serviceName + ".timeout")
+		service.MaxIdleConnections = viper.GetInt(serviceName + ".max_idle_connections")
+		service.KeepAlive = viper.GetDuration(serviceName + ".keep_alive")
+		service.Proxy = viper.GetString(serviceName + ".proxy")
+		if err := validateHTTPService(service); err != nil {
+			return service, errors.New("Fatal error reading config: " + serviceName + " has an invalid config: " + err.Error())
+		}
+	case FileService:
+		if !viper.IsSet(serviceName + ".file") {
+			return service, errors.New("Fatal error reading config: " + serviceName + " has an invalid config: file is not defined.")
+		}
+		service.File = viper.GetString(serviceName + ".file")
+	case NoopService, LogService:
+	default:
+		return service, errors.New("Fatal error reading config: " + serviceName + " has an invalid config: type '" + service.Type + "' is not valid.")
+	}
+
+	// Retry and circuit breaker settings are optional, zero values mean default ones
+	service.Retries = viper.GetInt(serviceName + ".retries")
+	service.RetryInitialDelay = viper.GetDuration(serviceName + ".retry_initial_delay")
+	service.RetryMaxDelay = viper.GetDuration(serviceName + ".retry_max_delay")
+	service.BreakerThreshold = viper.GetInt(serviceName + ".breaker_threshold")
+	service.BreakerTimeout = viper.GetDuration(serviceName + ".breaker_timeout")
+	if service.Retries < 0 || service.RetryInitialDelay < 0 || service.RetryMaxDelay < 0 || service.BreakerThreshold < 0 || service.BreakerTimeout < 0 {
+		return service, errors.New("Fatal error reading config: " + serviceName + " retry settings can't be negative.")
+	}
+	return service, nil
+}
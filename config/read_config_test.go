@@ -1,8 +1,14 @@
 package config
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
 )
 
 func TestProcessNoConfigFilePresent(t *testing.T) {
@@ -193,3 +199,1045 @@ func TestValisConfig(t *testing.T) {
 	}
 
 }
+
+func TestProcessWrapperWithoutOrder(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/wrapper_no_order/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with wrapper without order should fail.")
+	} else {
+		requiredError := "Fatal error reading config: wrapper secondwrapper has an invalid config: order is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessWrapperInvalidOrder(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/wrapper_invalid_order/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with wrapper invalid order should fail.")
+	} else {
+		requiredError := "Fatal error reading config: wrapper firstwrapper has an invalid config: order must be greater than 0."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessWrappersDuplicatedOrder(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/wrappers_duplicated_order/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with duplicated wrapper orders should fail.")
+	} else {
+		requiredError := "Fatal error reading config: wrappers firstwrapper and secondwrapper have the same order 1."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessWrappersOrderGap(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/wrappers_order_gap/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with gaps in wrapper orders should fail.")
+	} else {
+		requiredError := "Fatal error reading config: wrapper orders must be consecutive starting from 1, order 2 is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigWrappersOrder(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_custom_order/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	expectedOrder := []string{"secondwrapper", "thirdwrapper", "firstwrapper"}
+	if len(config.Wrappers) != len(expectedOrder) {
+		t.Fatalf("config.Wrappers should have %d wrappers, not %d.", len(expectedOrder), len(config.Wrappers))
+	}
+	for position, wrapperName := range expectedOrder {
+		if config.Wrappers[position].Name != wrapperName {
+			t.Errorf("config.Wrappers[%d] should be '%s' not '%s'", position, wrapperName, config.Wrappers[position].Name)
+		}
+	}
+}
+
+func TestProcessRoutesUnknownWrapper(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/routes_unknown_wrapper/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with routes using undefined wrappers should fail.")
+	} else {
+		requiredError := "Fatal error reading config: route artistinforetrieval uses wrapper thirdwrapper which is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessRoutesUnknownJobType(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/routes_unknown_job_type/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with routes using invalid job types should fail.")
+	} else {
+		requiredError := "Fatal error reading config: route foo is not a valid job type."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessRoutesEmptyRoute(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/routes_empty_route/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with empty routes should fail.")
+	} else {
+		requiredError := "Fatal error reading config: route artistinforetrieval has no wrappers."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessRoutesDuplicatedWrapper(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/routes_duplicated_wrapper/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with routes using the same wrapper twice should fail.")
+	} else {
+		requiredError := "Fatal error reading config: route artistinforetrieval uses wrapper firstwrapper more than once."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigRoutes(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_routes/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	if len(config.Routes) != 2 {
+		t.Errorf("config.Routes should have 2 routes, not %d.", len(config.Routes))
+	}
+	artistRoute := config.Routes[commontypes.ArtistInfoRetrieval]
+	if len(artistRoute) != 2 || artistRoute[0] != "secondwrapper" || artistRoute[1] != "firstwrapper" {
+		t.Errorf("ArtistInfoRetrieval route should be [secondwrapper firstwrapper], not %v.", artistRoute)
+	}
+	if _, ok := config.Routes[commontypes.JobInfoRetrieval]; ok {
+		t.Errorf("JobInfoRetrieval route shouldn't be defined.")
+	}
+}
+
+func TestValidConfigWithoutRoutes(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Routes != nil {
+		t.Errorf("config.Routes should be nil when no routes are defined.")
+	}
+}
+
+func TestProcessInvalidReconnectConfig(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_reconnect_config/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with negative reconnection settings should fail.")
+	} else {
+		requiredError := "Fatal error reading config: server reconnection settings can't be negative."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigReconnect(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_reconnect/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Server.ReconnectInitialDelay != 2*time.Second {
+		t.Errorf("config.Server.ReconnectInitialDelay should be 2s not '%s'", config.Server.ReconnectInitialDelay)
+	}
+	if config.Server.ReconnectMaxDelay != time.Minute {
+		t.Errorf("config.Server.ReconnectMaxDelay should be 1m not '%s'", config.Server.ReconnectMaxDelay)
+	}
+	if config.Server.ReconnectMaxAttempts != 10 {
+		t.Errorf("config.Server.ReconnectMaxAttempts should be 10 not '%d'", config.Server.ReconnectMaxAttempts)
+	}
+	if config.Server.ConfirmTimeout != 10*time.Second {
+		t.Errorf("config.Server.ConfirmTimeout should be 10s not '%s'", config.Server.ConfirmTimeout)
+	}
+	if config.Server.PublishRetries != 5 {
+		t.Errorf("config.Server.PublishRetries should be 5 not '%d'", config.Server.PublishRetries)
+	}
+}
+
+func TestProcessInvalidDeadLetterConfig(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_deadletter_config/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with empty deadletter exchange should fail.")
+	} else {
+		requiredError := "Fatal error reading config: deadletter has an invalid config: exchange and queue can't be empty."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigDefaultDeadLetter(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.DeadLetter.Exchange != "deadletter" || config.DeadLetter.Queue != "deadletter" {
+		t.Errorf("config.DeadLetter should use 'deadletter' as default exchange and queue, not %+v", config.DeadLetter)
+	}
+}
+
+func TestValidConfigDeadLetter(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_deadletter/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.DeadLetter.Exchange != "jobrouter-deadletter" {
+		t.Errorf("config.DeadLetter.Exchange should be 'jobrouter-deadletter' not '%s'", config.DeadLetter.Exchange)
+	}
+	if config.DeadLetter.Queue != "jobrouter-deadletter-jobs" {
+		t.Errorf("config.DeadLetter.Queue should be 'jobrouter-deadletter-jobs' not '%s'", config.DeadLetter.Queue)
+	}
+}
+
+func TestProcessInvalidShutdownConfig(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_shutdown_config/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with zero shutdown grace period should fail.")
+	} else {
+		requiredError := "Fatal error reading config: shutdown has an invalid config: grace_period must be greater than 0."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigShutdown(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_shutdown/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.ShutdownGracePeriod != time.Minute {
+		t.Errorf("config.ShutdownGracePeriod should be 1m not '%s'", config.ShutdownGracePeriod)
+	}
+}
+
+func TestValidConfigDefaultShutdown(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.ShutdownGracePeriod != 30*time.Second {
+		t.Errorf("config.ShutdownGracePeriod should be 30s by default not '%s'", config.ShutdownGracePeriod)
+	}
+}
+
+func TestValidConfigDefaultServices(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Status.Type != HTTPService || config.Status.Name != "status" {
+		t.Errorf("config.Status should be an http service named 'status' not '%+v'", config.Status)
+	}
+	if config.Storage.Type != HTTPService || config.Storage.Name != "storage" {
+		t.Errorf("config.Storage should be an http service named 'storage' not '%+v'", config.Storage)
+	}
+}
+
+func TestValidConfigServices(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_services/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Status.Type != FileService || config.Status.File != "/var/lib/jobrouter/status.log" {
+		t.Errorf("config.Status should be a file service writing to '/var/lib/jobrouter/status.log' not '%+v'", config.Status)
+	}
+	expectedStorage := Service{Type: HTTPService, Name: "storage", Timeout: 30 * time.Second, MaxIdleConnections: 10, KeepAlive: time.Minute, Proxy: "http://proxy.example.com:3128", Retries: 5, RetryInitialDelay: time.Second, RetryMaxDelay: 10 * time.Second, BreakerThreshold: 10, BreakerTimeout: time.Minute}
+	if config.Storage != expectedStorage {
+		t.Errorf("config.Storage should be '%+v' not '%+v'", expectedStorage, config.Storage)
+	}
+}
+
+func TestProcessInvalidServiceRetryConfig(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_service_retry_config/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with negative retries should fail.")
+	} else {
+		requiredError := "Fatal error reading config: status retry settings can't be negative."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessInvalidServiceType(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_service_type/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with unknown service type should fail.")
+	} else {
+		requiredError := "Fatal error reading config: storage has an invalid config: type 'ftp' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessFileServiceWithoutFile(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/file_service_without_file/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with file service without file should fail.")
+	} else {
+		requiredError := "Fatal error reading config: status has an invalid config: file is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigOutbox(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_outbox/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Outbox.Directory != "/var/lib/music-manager/jobrouter/outbox" {
+		t.Errorf("config.Outbox.Directory should be '/var/lib/music-manager/jobrouter/outbox' not '%s'", config.Outbox.Directory)
+	}
+	if config.Outbox.RetryInterval != 10*time.Second {
+		t.Errorf("config.Outbox.RetryInterval should be 10s not %s", config.Outbox.RetryInterval)
+	}
+}
+
+func TestValidConfigWithoutOutbox(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Outbox.Directory != "" {
+		t.Errorf("config.Outbox.Directory should be empty when outbox is not configured, not '%s'", config.Outbox.Directory)
+	}
+}
+
+func TestProcessInvalidOutboxConfig(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_outbox_config/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with outbox without directory should fail.")
+	} else {
+		requiredError := "Fatal error reading config: outbox has an invalid config: directory is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigHTTPSServices(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_https_services/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Status.Endpoint() != "https://status.example.com:8443/api/jobs" {
+		t.Errorf("config.Status.Endpoint() should be 'https://status.example.com:8443/api/jobs' not '%s'", config.Status.Endpoint())
+	}
+	if config.Status.Token != "status-token" || config.Status.CAFile != "./config_files_test/valid_config_https_services/ca.pem" {
+		t.Errorf("config.Status should have token and CA file, it was %+v", config.Status)
+	}
+	if config.Storage.Username != "jobrouter" || config.Storage.Password != "storage-pass" {
+		t.Errorf("config.Storage should have basic auth credentials, it was %+v", config.Storage)
+	}
+	if config.Storage.CertFile != "./config_files_test/valid_config_https_services/jobrouter.pem" || config.Storage.KeyFile != "./config_files_test/valid_config_https_services/jobrouter-key.pem" {
+		t.Errorf("config.Storage should have client certificate, it was %+v", config.Storage)
+	}
+}
+
+func TestValidConfigServiceEndpointFromName(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Status.Endpoint() != "http://"+config.Status.Name {
+		t.Errorf("config.Status.Endpoint() should be 'http://%s' not '%s'", config.Status.Name, config.Status.Endpoint())
+	}
+}
+
+func TestProcessInvalidServiceURL(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_service_url/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with unsupported url scheme should fail.")
+	} else {
+		requiredError := "Fatal error reading config: status has an invalid config: url 'ftp://status.example.com' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessServiceTokenAndBasicAuth(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/service_token_and_basic_auth/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with token and basic auth should fail.")
+	} else {
+		requiredError := "Fatal error reading config: storage has an invalid config: token and basic auth credentials can't be used together."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessServiceCertWithoutKey(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/service_cert_without_key/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with cert_file without key_file should fail.")
+	} else {
+		requiredError := "Fatal error reading config: status has an invalid config: cert_file and key_file must be defined together."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessServiceTLSOverHTTP(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/service_tls_over_http/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with ca_file and http url should fail.")
+	} else {
+		requiredError := "Fatal error reading config: storage has an invalid config: ca_file, cert_file and key_file require an https url."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessServiceMissingCAFile(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/service_missing_ca_file/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with missing service CA file should fail.")
+	} else {
+		requiredError := "Fatal error reading config: status has an invalid config: file './config_files_test/service_missing_ca_file/ca.pem' can't be read."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessInvalidServiceClientConfig(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_service_client_config/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with negative timeout should fail.")
+	} else {
+		requiredError := "Fatal error reading config: status has an invalid config: http client settings can't be negative."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessInvalidServiceProxy(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_service_proxy/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with proxy without scheme should fail.")
+	} else {
+		requiredError := "Fatal error reading config: storage has an invalid config: proxy 'proxy.example.com' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigAMQPS(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_amqps/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	if !config.Server.TLS || config.Server.CAFile != "./config_files_test/valid_config_amqps/ca.pem" {
+		t.Errorf("config.Server should use TLS with CA file, it was %+v", config.Server)
+	}
+	if config.Server.CertFile != "./config_files_test/valid_config_amqps/jobrouter.pem" || config.Server.KeyFile != "./config_files_test/valid_config_amqps/jobrouter-key.pem" {
+		t.Errorf("config.Server should have client certificate, it was %+v", config.Server)
+	}
+	if config.Server.VHost != "music-manager" || config.Server.Heartbeat != 30*time.Second || config.Server.ConnectionName != "jobrouter-1" || config.Server.Locale != "en_US" {
+		t.Errorf("config.Server should have connection settings, it was %+v", config.Server)
+	}
+}
+
+func TestProcessServerMissingCAFile(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/server_missing_ca_file/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with missing CA file should fail.")
+	} else {
+		requiredError := "Fatal error reading config: server has an invalid config: file './config_files_test/server_missing_ca_file/ca.pem' can't be read."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessServerTLSFilesWithoutTLS(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/server_tls_files_without_tls/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with CA file without tls should fail.")
+	} else {
+		requiredError := "Fatal error reading config: server has an invalid config: ca_file, cert_file and key_file require tls."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+// secretsConfigLocation copies config.toml of fixture to a temporary folder and writes secrets there with mode,
+// fixture paths in config.toml point to that folder. Git does not keep file permissions so secret files are not fixtures.
+func secretsConfigLocation(t *testing.T, fixture string, secrets map[string]string, mode os.FileMode) string {
+	directory := t.TempDir()
+	content, err := ioutil.ReadFile(filepath.Join("./config_files_test", fixture, "config.toml"))
+	if err != nil {
+		t.Fatalf("Fixture %s should be readable, error was '%s'.", fixture, err.Error())
+	}
+	content = bytes.ReplaceAll(content, []byte("./config_files_test/"+fixture), []byte(directory))
+	if err := ioutil.WriteFile(filepath.Join(directory, "config.toml"), content, 0600); err != nil {
+		t.Fatalf("Config file should be written, error was '%s'.", err.Error())
+	}
+	for name, secret := range secrets {
+		file := filepath.Join(directory, name)
+		if err := ioutil.WriteFile(file, []byte(secret), mode); err != nil {
+			t.Fatalf("Secret file should be written, error was '%s'.", err.Error())
+		}
+		// umask could have removed permissions
+		if err := os.Chmod(file, mode); err != nil {
+			t.Fatalf("Secret file mode should be set, error was '%s'.", err.Error())
+		}
+	}
+	return directory
+}
+
+// validSecretsConfigLocation returns the location of valid_config_secrets fixture with secret files only readable by their owner
+func validSecretsConfigLocation(t *testing.T) string {
+	return secretsConfigLocation(t, "valid_config_secrets", map[string]string{
+		"rabbitmq_password": "file-password\n",
+		"storage_token":     "storage-token\n",
+	}, 0600)
+}
+
+func TestValidConfigSecrets(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", validSecretsConfigLocation(t))
+	os.Setenv("JOBROUTER_TEST_STATUS_TOKEN", "status-token")
+	defer os.Unsetenv("JOBROUTER_TEST_STATUS_TOKEN")
+
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Server.User != "guest" {
+		t.Errorf("config.Server.User should be taken from user when its environment variable is not set, not '%s'", config.Server.User)
+	}
+	if config.Server.Password != "file-password" {
+		t.Errorf("config.Server.Password should be taken from password_file, not '%s'", config.Server.Password)
+	}
+	if config.Status.Token != "status-token" {
+		t.Errorf("config.Status.Token should be taken from token_env, not '%s'", config.Status.Token)
+	}
+	if config.Storage.Token != "storage-token" {
+		t.Errorf("config.Storage.Token should be taken from token_file, not '%s'", config.Storage.Token)
+	}
+}
+
+func TestValidConfigSecretsEnvironmentPrecedence(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", validSecretsConfigLocation(t))
+	os.Setenv("JOBROUTER_TEST_STATUS_TOKEN", "status-token")
+	os.Setenv("JOBROUTER_TEST_RABBITMQ_USER", "env-user")
+	os.Setenv("JOBROUTER_TEST_RABBITMQ_PASSWORD", "env-password")
+	defer os.Unsetenv("JOBROUTER_TEST_STATUS_TOKEN")
+	defer os.Unsetenv("JOBROUTER_TEST_RABBITMQ_USER")
+	defer os.Unsetenv("JOBROUTER_TEST_RABBITMQ_PASSWORD")
+
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Server.User != "env-user" || config.Server.Password != "env-password" {
+		t.Errorf("config.Server credentials should be taken from environment variables, not '%s' and '%s'", config.Server.User, config.Server.Password)
+	}
+}
+
+func TestEnvironmentOverridesSecretFile(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", validSecretsConfigLocation(t))
+	defer setEnvironment(map[string]string{
+		"JOBROUTER_TEST_STATUS_TOKEN":   "status-token",
+		"MUSIC_MANAGER_SERVER_PASSWORD": "override-password",
+		"MUSIC_MANAGER_STATUS_TOKEN":    "override-token",
+	})()
+
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with environment overrides shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Server.Password != "override-password" {
+		t.Errorf("config.Server.Password should be taken from MUSIC_MANAGER_SERVER_PASSWORD instead of password_file, not '%s'", config.Server.Password)
+	}
+	if config.Status.Token != "override-token" {
+		t.Errorf("config.Status.Token should be taken from MUSIC_MANAGER_STATUS_TOKEN instead of token_env, not '%s'", config.Status.Token)
+	}
+}
+
+func TestProcessWorldReadableSecretFile(t *testing.T) {
+	location := secretsConfigLocation(t, "world_readable_secret_file", map[string]string{"rabbitmq_password": "file-password\n"}, 0644)
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", location)
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with world readable secret file should fail.")
+	} else {
+		requiredError := "Fatal error reading config: server has an invalid config: secret file '" + filepath.Join(location, "rabbitmq_password") + "' can't be readable by everyone."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessMissingSecretEnvironmentVariable(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/missing_secret_env/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with unset secret environment variable should fail.")
+	} else {
+		requiredError := "Fatal error reading config: status has an invalid config: token_env variable 'JOBROUTER_TEST_MISSING_TOKEN' is not set."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+// setEnvironment sets variables and returns a function that unsets them
+func setEnvironment(variables map[string]string) func() {
+	for name, value := range variables {
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name := range variables {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestEnvironmentOverridesConfigFile(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	defer setEnvironment(map[string]string{
+		"MUSIC_MANAGER_SERVER_HOST":                "rabbitmq.example.com",
+		"MUSIC_MANAGER_SERVER_PORT":                "5671",
+		"MUSIC_MANAGER_WRAPPERS_FIRSTWRAPPER_NAME": "renamedwrapper",
+		"MUSIC_MANAGER_STATUS_RETRIES":             "7",
+		"MUSIC_MANAGER_SHUTDOWN_GRACE_PERIOD":      "1m",
+		"MUSIC_MANAGER_ROUTES_ARTISTINFORETRIEVAL": "secondwrapper,firstwrapper",
+	})()
+
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with environment overrides shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Server.Host != "rabbitmq.example.com" || config.Server.Port != 5671 {
+		t.Errorf("config.Server host and port should be taken from environment, not '%s' and %d", config.Server.Host, config.Server.Port)
+	}
+	if config.Server.User != "guest" || config.Server.Password != "pass" {
+		t.Errorf("config.Server credentials should be taken from config file when they are not overridden, not '%s' and '%s'", config.Server.User, config.Server.Password)
+	}
+	if config.Wrappers[0].Name != "renamedwrapper" || config.Wrappers[1].Name != "secondwrapper" {
+		t.Errorf("config.Wrappers should be 'renamedwrapper' and 'secondwrapper', not %+v", config.Wrappers)
+	}
+	if config.Status.Retries != 7 || config.Status.Name != "status" {
+		t.Errorf("config.Status retries should be taken from environment and name from config file, it was %+v", config.Status)
+	}
+	if config.ShutdownGracePeriod != time.Minute {
+		t.Errorf("config.ShutdownGracePeriod should be 1m, not %s", config.ShutdownGracePeriod)
+	}
+	route := config.Routes[commontypes.ArtistInfoRetrieval]
+	if len(route) != 2 || route[0] != "secondwrapper" || route[1] != "renamedwrapper" {
+		t.Errorf("artistinforetrieval route should be 'secondwrapper' and 'renamedwrapper', not %v", route)
+	}
+}
+
+func TestConfigFromEnvironmentOnly(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", t.TempDir())
+	defer setEnvironment(map[string]string{
+		"MUSIC_MANAGER_SERVER_HOST":                  "rabbitmq",
+		"MUSIC_MANAGER_SERVER_PORT":                  "5672",
+		"MUSIC_MANAGER_SERVER_USER":                  "guest",
+		"MUSIC_MANAGER_SERVER_PASSWORD":              "pass",
+		"MUSIC_MANAGER_WRAPPERS_FIRST_WRAPPER_NAME":  "first",
+		"MUSIC_MANAGER_WRAPPERS_FIRST_WRAPPER_ORDER": "1",
+		"MUSIC_MANAGER_WRAPPERS_SECOND_NAME":         "second",
+		"MUSIC_MANAGER_WRAPPERS_SECOND_ORDER":        "2",
+		"MUSIC_MANAGER_JOBMANAGER_NAME":              "jobmanager",
+		"MUSIC_MANAGER_WRAPPEROUTPUT_NAME":           "wrapperoutput",
+		"MUSIC_MANAGER_STATUS_NAME":                  "status",
+		"MUSIC_MANAGER_STORAGE_URL":                  "https://storage.example.com/jobs",
+		"MUSIC_MANAGER_OUTBOX_DIRECTORY":             "/var/lib/music-manager/jobrouter/outbox",
+	})()
+
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with config defined in environment shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Server.Host != "rabbitmq" || config.Server.Port != 5672 || config.Server.User != "guest" || config.Server.Password != "pass" {
+		t.Errorf("config.Server should be taken from environment, it was %+v", config.Server)
+	}
+	if len(config.Wrappers) != 2 || config.Wrappers[0].Name != "first" || config.Wrappers[1].Name != "second" {
+		t.Errorf("config.Wrappers should be 'first' and 'second', not %+v", config.Wrappers)
+	}
+	if config.JobManager.Name != "jobmanager" || config.WrapperOutput.Name != "wrapperoutput" {
+		t.Errorf("Queues should be taken from environment, they were %+v and %+v", config.JobManager, config.WrapperOutput)
+	}
+	if config.Status.Endpoint() != "http://status" || config.Storage.Endpoint() != "https://storage.example.com/jobs" {
+		t.Errorf("Services should be taken from environment, they were %+v and %+v", config.Status, config.Storage)
+	}
+	if config.Outbox.Directory != "/var/lib/music-manager/jobrouter/outbox" {
+		t.Errorf("config.Outbox.Directory should be taken from environment, not '%s'", config.Outbox.Directory)
+	}
+}
+
+func TestConfigFromEnvironmentOnlyIncomplete(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", t.TempDir())
+	defer setEnvironment(map[string]string{
+		"MUSIC_MANAGER_SERVER_HOST": "rabbitmq",
+	})()
+
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with incomplete config defined in environment should fail.")
+	} else {
+		requiredError := "Fatal error reading config: no server port was found."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigHTTP(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_http/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.HTTP.Address != ":9102" {
+		t.Errorf("config.HTTP.Address should be ':9102' not '%s'", config.HTTP.Address)
+	}
+	if config.HTTP.LivenessTimeout != 2*time.Minute {
+		t.Errorf("config.HTTP.LivenessTimeout should be 2m not '%s'", config.HTTP.LivenessTimeout)
+	}
+}
+
+func TestProcessInvalidHTTPConfig(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_http_config/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with http address without port should fail.")
+	} else {
+		requiredError := "Fatal error reading config: http has an invalid config: address '9102' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessHTTPNegativeLivenessTimeout(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/http_negative_liveness_timeout/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with negative http liveness_timeout should fail.")
+	} else {
+		requiredError := "Fatal error reading config: http has an invalid config: liveness_timeout can't be negative."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigLog(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_log/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Log.Level != "debug" || config.Log.Format != JSONFormat {
+		t.Errorf("config.Log should be debug level and json format, not %+v", config.Log)
+	}
+}
+
+func TestValidConfigDefaultLog(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Log.Level != "info" || config.Log.Format != LogfmtFormat {
+		t.Errorf("config.Log should be info level and logfmt format by default, not %+v", config.Log)
+	}
+}
+
+func TestEnvironmentOverridesLogLevel(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_log/")
+	defer setEnvironment(map[string]string{
+		"MUSIC_MANAGER_LOG_LEVEL": "error",
+	})()
+
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with environment overrides shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Log.Level != "error" || config.Log.Format != JSONFormat {
+		t.Errorf("config.Log level should be taken from environment and format from config file, it was %+v", config.Log)
+	}
+}
+
+func TestProcessInvalidLogLevel(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_log_level/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with unknown log level should fail.")
+	} else {
+		requiredError := "Fatal error reading config: log has an invalid config: level 'verbose' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessInvalidLogFormat(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_log_format/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with unknown log format should fail.")
+	} else {
+		requiredError := "Fatal error reading config: log has an invalid config: format 'xml' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigTracingOTLP(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_tracing_otlp/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	expectedTracing := Tracing{Exporter: OTLPExporter, Endpoint: "otel-collector:4318", Insecure: true, SampleRatio: 0.25}
+	if config.Tracing != expectedTracing {
+		t.Errorf("config.Tracing should be %+v not %+v", expectedTracing, config.Tracing)
+	}
+}
+
+func TestValidConfigTracingFile(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_tracing_file/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	expectedTracing := Tracing{Exporter: FileExporter, File: "/var/log/music-manager/traces.json", SampleRatio: 1}
+	if config.Tracing != expectedTracing {
+		t.Errorf("config.Tracing should be %+v not %+v", expectedTracing, config.Tracing)
+	}
+}
+
+func TestValidConfigWithoutTracing(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Errorf("ReadConfig method with valid config shouldn't fail.")
+	}
+	if config.Tracing.Exporter != "" {
+		t.Errorf("config.Tracing.Exporter should be empty without tracing section, not '%s'", config.Tracing.Exporter)
+	}
+}
+
+func TestProcessTracingInvalidExporter(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/tracing_invalid_exporter/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with unknown tracing exporter should fail.")
+	} else {
+		requiredError := "Fatal error reading config: tracing has an invalid config: exporter 'jaeger' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessTracingFileNotDefined(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/tracing_file_not_defined/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with file tracing exporter without file should fail.")
+	} else {
+		requiredError := "Fatal error reading config: tracing has an invalid config: file is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessTracingInvalidEndpoint(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/tracing_invalid_endpoint/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with tracing endpoint without port should fail.")
+	} else {
+		requiredError := "Fatal error reading config: tracing has an invalid config: endpoint 'otel-collector' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessTracingInvalidSampleRatio(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/tracing_invalid_sample_ratio/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with tracing sample_ratio greater than 1 should fail.")
+	} else {
+		requiredError := "Fatal error reading config: tracing has an invalid config: sample_ratio must be between 0 and 1."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigAdmin(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_admin/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	expectedAdmin := Admin{Token: "secret", RecentDecisions: 50}
+	if config.Admin != expectedAdmin {
+		t.Errorf("config.Admin should be %+v not %+v", expectedAdmin, config.Admin)
+	}
+}
+
+func TestValidConfigWithoutAdmin(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_http/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Admin.Token != "" {
+		t.Errorf("Admin API should be disabled when admin is not defined, config.Admin was %+v", config.Admin)
+	}
+}
+
+func TestProcessAdminWithoutHTTP(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/admin_without_http/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with admin but without http should fail.")
+	} else {
+		requiredError := "Fatal error reading config: admin has an invalid config: http section is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessAdminTokenNotDefined(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/admin_token_not_defined/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with admin without token should fail.")
+	} else {
+		requiredError := "Fatal error reading config: admin has an invalid config: token is not defined."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestProcessAdminNegativeRecentDecisions(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/admin_negative_recent_decisions/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with negative admin recent_decisions should fail.")
+	} else {
+		requiredError := "Fatal error reading config: admin has an invalid config: recent_decisions can't be negative."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
+
+func TestValidConfigMemoryBroker(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config_memory_broker/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with memory broker shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Server != (Server{Type: MemoryBroker}) {
+		t.Errorf("config.Server should only have memory type, not %+v", config.Server)
+	}
+}
+
+func TestValidConfigDefaultBroker(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/valid_config/")
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig method with valid config shouldn't fail, error was '%s'.", err.Error())
+	}
+	if config.Server.Type != RabbitMQBroker {
+		t.Errorf("config.Server.Type should be rabbitmq by default, not '%s'", config.Server.Type)
+	}
+}
+
+func TestProcessInvalidServerType(t *testing.T) {
+	os.Setenv("MUSIC_MANAGER_SERVICE_CONFIG_FILE_LOCATION", "./config_files_test/invalid_server_type/")
+	_, err := ReadConfig()
+	if err == nil {
+		t.Errorf("ReadConfig method with unknown server type should fail.")
+	} else {
+		requiredError := "Fatal error reading config: server has an invalid config: type 'kafka' is not valid."
+		if err.Error() != requiredError {
+			t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+		}
+	}
+}
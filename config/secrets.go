@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	viperLib "github.com/spf13/viper"
+)
+
+// secretIsSet reports whether secret key is defined inline, as a file or as an environment variable
+func secretIsSet(viper *viperLib.Viper, key string) bool {
+	return viper.IsSet(key) || viper.IsSet(key+"_file") || viper.IsSet(key+"_env")
+}
+
+// readSecret returns secret key, it is taken from the prefixed environment variable that overrides key, from the one named by key_env,
+// from the file in key_file or from key itself, in that order. Secret files can't be readable by everyone.
+func readSecret(viper *viperLib.Viper, key string) (string, error) {
+	name := key[strings.LastIndex(key, ".")+1:]
+
+	// Like any other option, key is overridden by its prefixed environment variable
+	if value, found := os.LookupEnv(environmentVariable(key)); found {
+		return value, nil
+	}
+
+	if viper.IsSet(key + "_env") {
+		variable := viper.GetString(key + "_env")
+		if value, found := os.LookupEnv(variable); found {
+			return value, nil
+		}
+		if !viper.IsSet(key+"_file") && !viper.IsSet(key) {
+			return "", errors.New(name + "_env variable '" + variable + "' is not set.")
+		}
+	}
+
+	if viper.IsSet(key + "_file") {
+		return readSecretFile(viper.GetString(key + "_file"))
+	}
+
+	return viper.GetString(key), nil
+}
+
+// readSecretFile returns file content without trailing line breaks
+func readSecretFile(file string) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil || info.IsDir() {
+		return "", errors.New("secret file '" + file + "' can't be read.")
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		return "", errors.New("secret file '" + file + "' can't be readable by everyone.")
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.New("secret file '" + file + "' can't be read.")
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
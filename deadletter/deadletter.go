@@ -0,0 +1,59 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/tracing"
+)
+
+// Reason describes why a message has been dead-lettered
+type Reason string
+
+const (
+	DecodeError           Reason = "decode-error"
+	UnknownWrapper        Reason = "unknown-wrapper"
+	InvalidOrigin         Reason = "invalid-origin"
+	StatusServiceFailure  Reason = "status-service-failure"
+	StorageServiceFailure Reason = "storage-service-failure"
+)
+
+// Headers added to dead-lettered messages
+const (
+	ReasonHeader      = "x-jobrouter-reason"
+	ErrorHeader       = "x-jobrouter-error"
+	SourceQueueHeader = "x-jobrouter-source-queue"
+	JobIDHeader       = "x-jobrouter-job-id"
+)
+
+// DeadLetter publishes messages that JobRouter can't route to the configured dead letter exchange
+type DeadLetter struct {
+	broker broker.Broker
+	config config.DeadLetter
+}
+
+// New declares dead letter exchange and queue on jobBroker, jobBroker must not have been used yet.
+// jobBroker must wait for publishing confirmations so messages can be acknowledged once Send returns.
+func New(jobBroker broker.Broker, deadLetterConfig config.DeadLetter) *DeadLetter {
+	jobBroker.Bind(deadLetterConfig.Exchange, deadLetterConfig.Queue)
+	return &DeadLetter{broker: jobBroker, config: deadLetterConfig}
+}
+
+// Send publishes body to dead letter exchange, headers describe the reason, the error, the queue body came from and its job ID if known.
+// Trace context of ctx is sent too.
+func (d *DeadLetter) Send(ctx context.Context, body []byte, reason Reason, sourceQueue string, jobID string, detail string) error {
+	headers := map[string]interface{}{
+		ReasonHeader:      string(reason),
+		ErrorHeader:       detail,
+		SourceQueueHeader: sourceQueue,
+		JobIDHeader:       jobID,
+	}
+	tracing.Propagator.Inject(ctx, tracing.HeadersCarrier(headers))
+	err := d.broker.PublishToExchange(ctx, d.config.Exchange, "", broker.Message{Headers: headers, Body: body})
+	if err != nil {
+		return fmt.Errorf("Failed to send message to dead letter exchange %s: %w", d.config.Exchange, err)
+	}
+	return nil
+}
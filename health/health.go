@@ -0,0 +1,143 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/circuit"
+)
+
+// DefaultLivenessTimeout is how long a loop can be busy with the same job before it is considered wedged
+const DefaultLivenessTimeout = 5 * time.Minute
+
+var (
+	loopsMutex sync.Mutex
+	// busyLoops keeps when each busy loop started its current job
+	busyLoops = make(map[string]time.Time)
+)
+
+// Busy records that loop has started processing a job
+func Busy(loop string) {
+	loopsMutex.Lock()
+	defer loopsMutex.Unlock()
+
+	busyLoops[loop] = time.Now()
+}
+
+// Idle records that loop has finished its job and is waiting for the next one
+func Idle(loop string) {
+	loopsMutex.Lock()
+	defer loopsMutex.Unlock()
+
+	delete(busyLoops, loop)
+}
+
+// Check returns an error when a dependency is not ready
+type Check func() error
+
+// Connected returns a Check that fails while connection is not open
+func Connected(connection interface{ Connected() bool }) Check {
+	return func() error {
+		if !connection.Connected() {
+			return errors.New("RabbitMQ connection is not open.")
+		}
+		return nil
+	}
+}
+
+// BreakerClosed returns a Check that fails while breaker is open, half-open breakers are ready to try the service again
+func BreakerClosed(breaker *circuit.Breaker) Check {
+	return func() error {
+		if breaker.State() == circuit.Open {
+			return circuit.ErrOpen
+		}
+		return nil
+	}
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker tells whether JobRouter is alive and ready using loops activity and readiness checks
+type Checker struct {
+	livenessTimeout time.Duration
+	checks          []namedCheck
+	now             func() time.Time
+}
+
+// NewChecker creates a Checker, zero livenessTimeout means DefaultLivenessTimeout
+func NewChecker(livenessTimeout time.Duration) *Checker {
+	if livenessTimeout <= 0 {
+		livenessTimeout = DefaultLivenessTimeout
+	}
+	return &Checker{livenessTimeout: livenessTimeout, now: time.Now}
+}
+
+// AddReadinessCheck adds check to readiness, name identifies it in errors
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Live returns an error when a loop has been busy with the same job for longer than liveness timeout
+func (c *Checker) Live() error {
+	loopsMutex.Lock()
+	defer loopsMutex.Unlock()
+
+	var wedged []string
+	for loop, since := range busyLoops {
+		if busy := c.now().Sub(since); busy > c.livenessTimeout {
+			wedged = append(wedged, fmt.Sprintf("%s has been busy for %s", loop, busy.Round(time.Second)))
+		}
+	}
+	if len(wedged) > 0 {
+		sort.Strings(wedged)
+		return fmt.Errorf("Wedged loops: %s.", strings.Join(wedged, ", "))
+	}
+	return nil
+}
+
+// Ready returns an error when JobRouter is not alive or any readiness check fails
+func (c *Checker) Ready() error {
+	var failures []string
+	if err := c.Live(); err != nil {
+		failures = append(failures, err.Error())
+	}
+	for _, check := range c.checks {
+		if err := check.check(); err != nil {
+			failures = append(failures, check.name+": "+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// LivenessHandler serves Live result, 503 status code means JobRouter is not alive
+func (c *Checker) LivenessHandler() http.Handler {
+	return handler(c.Live)
+}
+
+// ReadinessHandler serves Ready result, 503 status code means JobRouter is not ready
+func (c *Checker) ReadinessHandler() http.Handler {
+	return handler(c.Ready)
+}
+
+func handler(check Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err.Error())
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,98 @@
+// +build integration_tests unit_tests
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/circuit"
+)
+
+type ConnectionMock struct {
+	connected bool
+}
+
+func (cm ConnectionMock) Connected() bool {
+	return cm.connected
+}
+
+func TestLiveWithWedgedLoop(t *testing.T) {
+
+	checker := NewChecker(time.Minute)
+	Busy("TestLiveWithWedgedLoop")
+	defer Idle("TestLiveWithWedgedLoop")
+
+	if err := checker.Live(); err != nil {
+		t.Errorf("Loop busy for less than liveness timeout should be alive, error was '%s'.", err.Error())
+	}
+
+	checker.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	err := checker.Live()
+	if err == nil || !strings.Contains(err.Error(), "TestLiveWithWedgedLoop") {
+		t.Errorf("Loop busy for longer than liveness timeout should be wedged, error was '%v'.", err)
+	}
+
+	Idle("TestLiveWithWedgedLoop")
+	if err := checker.Live(); err != nil {
+		t.Errorf("Idle loops should never be wedged, error was '%s'.", err.Error())
+	}
+}
+
+func TestReadyAggregatesChecks(t *testing.T) {
+
+	checker := NewChecker(0)
+	checker.AddReadinessCheck("connected", Connected(ConnectionMock{connected: true}))
+	checker.AddReadinessCheck("passing", func() error { return nil })
+	if err := checker.Ready(); err != nil {
+		t.Errorf("Ready should not fail when every check passes, error was '%s'.", err.Error())
+	}
+
+	checker.AddReadinessCheck("disconnected", Connected(ConnectionMock{}))
+	checker.AddReadinessCheck("failing", func() error { return errors.New("Test.") })
+	err := checker.Ready()
+	if err == nil {
+		t.Fatalf("Ready should fail when any check fails.")
+	}
+	requiredError := "disconnected: RabbitMQ connection is not open.\nfailing: Test."
+	if err.Error() != requiredError {
+		t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+	}
+}
+
+func TestBreakerClosed(t *testing.T) {
+
+	breaker := circuit.New(1, time.Minute)
+	check := BreakerClosed(breaker)
+	if err := check(); err != nil {
+		t.Errorf("Closed breaker should be ready, error was '%s'.", err.Error())
+	}
+
+	breaker.Call(context.Background(), func(context.Context) error { return errors.New("Test.") })
+	if err := check(); !errors.Is(err, circuit.ErrOpen) {
+		t.Errorf("Open breaker should not be ready, error was '%v'.", err)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+
+	checker := NewChecker(0)
+	checker.AddReadinessCheck("disconnected", Connected(ConnectionMock{}))
+
+	recorder := httptest.NewRecorder()
+	checker.LivenessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK || strings.TrimSpace(recorder.Body.String()) != "ok" {
+		t.Errorf("Liveness should answer 200 ok, it answered %d '%s'.", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	checker.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "disconnected") {
+		t.Errorf("Readiness should answer 503 naming failing check, it answered %d '%s'.", recorder.Code, recorder.Body.String())
+	}
+}
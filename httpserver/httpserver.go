@@ -0,0 +1,49 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ShutdownTimeout is the maximum time Run waits for in flight requests once it is stopped
+const ShutdownTimeout = 5 * time.Second
+
+// Server serves JobRouter http endpoints like /metrics
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// New creates a Server listening on address, handlers must be added before running it
+func New(address string) *Server {
+	mux := http.NewServeMux()
+	return &Server{mux: mux, server: &http.Server{Addr: address, Handler: mux}}
+}
+
+// Handle registers handler for pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Run serves requests until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	serverDone := make(chan error, 1)
+	go func() { serverDone <- s.server.ListenAndServe() }()
+
+	select {
+	case err := <-serverDone:
+		return fmt.Errorf("Failed to serve http endpoints: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Failed to stop http server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// +build integration_tests unit_tests
+
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunStopsWhenContextIsCancelled(t *testing.T) {
+
+	server := New("127.0.0.1:0")
+	server.Handle("/metrics", http.NotFoundHandler())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serverDone := make(chan error)
+	go func() { serverDone <- server.Run(ctx) }()
+	cancel()
+
+	select {
+	case err := <-serverDone:
+		if err != nil {
+			t.Errorf("Run should return no errors when it is stopped, error was '%s'.", err.Error())
+		}
+	case <-time.After(ShutdownTimeout):
+		t.Errorf("Run should return once it is stopped.")
+	}
+}
+
+func TestRunFailsWithInvalidAddress(t *testing.T) {
+
+	err := New("invalid address").Run(context.Background())
+	if err == nil {
+		t.Errorf("Run should fail when it can't listen on address.")
+	}
+}
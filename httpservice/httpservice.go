@@ -0,0 +1,215 @@
+package httpservice
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/retry"
+	"github.com/a-castellano/music-manager-job-router/tlsconfig"
+	"github.com/a-castellano/music-manager-job-router/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultTimeout            = 5 * time.Second
+	DefaultMaxIdleConnections = 2
+	DefaultKeepAlive          = 30 * time.Second
+)
+
+const (
+	// MaxErrorBodyLength is the number of response body bytes kept in Error
+	MaxErrorBodyLength = 512
+	// maxDrainLength limits how much of a response body is read so its connection can be reused
+	maxDrainLength = 1 << 20
+)
+
+// Error is returned when a service can't be reached or it does not accept a job.
+// StatusCode is 0 when no response was received, Err holds the reason in that case.
+type Error struct {
+	Service    string
+	URL        string
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("Failed to call %s service at %s: %v", e.Service, e.URL, e.Err)
+	}
+	if e.Body == "" {
+		return fmt.Sprintf("%s service at %s answered with status code %d.", e.Service, e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("%s service at %s answered with status code %d: %s", e.Service, e.URL, e.StatusCode, e.Body)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Endpoint is where jobs are posted, Service names it in returned errors.
+// Token is sent as a bearer token, Username and Password are sent using basic auth.
+type Endpoint struct {
+	Service  string
+	URL      string
+	Token    string
+	Username string
+	Password string
+}
+
+// NewEndpoint creates the Endpoint of an http service called service
+func NewEndpoint(service string, serviceConfig config.Service) Endpoint {
+	return Endpoint{
+		Service:  service,
+		URL:      serviceConfig.Endpoint(),
+		Token:    serviceConfig.Token,
+		Username: serviceConfig.Username,
+		Password: serviceConfig.Password,
+	}
+}
+
+// NewClient creates the http client used to call a service, serviceConfig decides its timeouts, connection pool, proxy and TLS settings
+func NewClient(serviceConfig config.Service) (http.Client, error) {
+
+	timeout := serviceConfig.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	maxIdleConnections := serviceConfig.MaxIdleConnections
+	if maxIdleConnections <= 0 {
+		maxIdleConnections = DefaultMaxIdleConnections
+	}
+	keepAlive := serviceConfig.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultKeepAlive
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: keepAlive}).DialContext
+	transport.MaxIdleConns = maxIdleConnections
+	transport.MaxIdleConnsPerHost = maxIdleConnections
+	if serviceConfig.Proxy != "" {
+		proxyURL, err := url.Parse(serviceConfig.Proxy)
+		if err != nil {
+			return http.Client{}, fmt.Errorf("Failed to parse proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig, err := tlsconfig.New(serviceConfig.CAFile, serviceConfig.CertFile, serviceConfig.KeyFile)
+	if err != nil {
+		return http.Client{}, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// PostJob posts job as JSON to endpoint using client, each call is a span and trace context of ctx is sent along with job.
+// Errors are *Error, they are marked as permanent unless trying again could work.
+func PostJob(ctx context.Context, client http.Client, endpoint Endpoint, job commontypes.Job) error {
+	ctx, span := tracing.Tracer().Start(ctx, "POST "+endpoint.Service, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPMethodKey.String(http.MethodPost),
+		semconv.HTTPURLKey.String(endpoint.URL),
+		semconv.PeerServiceKey.String(endpoint.Service),
+	))
+	err := postJob(ctx, client, endpoint, job)
+	tracing.End(span, err)
+	return err
+}
+
+func postJob(ctx context.Context, client http.Client, endpoint Endpoint, job commontypes.Job) error {
+
+	jsonJob, _ := json.Marshal(job)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewBuffer(jsonJob))
+	if err != nil {
+		return retry.Permanent(&Error{Service: endpoint.Service, URL: endpoint.URL, Err: err})
+	}
+	request.Header.Set("Content-Type", "application/json")
+	tracing.Propagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
+	if endpoint.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+endpoint.Token)
+	} else if endpoint.Username != "" {
+		request.SetBasicAuth(endpoint.Username, endpoint.Password)
+	}
+	jobType := metrics.JobType(job.Type)
+	start := time.Now()
+	resp, err := client.Do(request)
+	metrics.ServiceRequestDuration.WithLabelValues(endpoint.Service, jobType).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.ServiceRequests.WithLabelValues(endpoint.Service, "error", jobType).Inc()
+		if permanentClientError(err) {
+			return retry.Permanent(&Error{Service: endpoint.Service, URL: endpoint.URL, Err: err})
+		}
+		return &Error{Service: endpoint.Service, URL: endpoint.URL, Err: err}
+	}
+	metrics.ServiceRequests.WithLabelValues(endpoint.Service, strconv.Itoa(resp.StatusCode), jobType).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	defer drainAndClose(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		err := &Error{Service: endpoint.Service, URL: endpoint.URL, StatusCode: resp.StatusCode, Body: readErrorBody(resp.Body)}
+		if !retry.RetryableHTTPStatus(resp.StatusCode) {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// permanentClientError reports whether err, returned by an http client, won't go away by trying again.
+// Certificates that can't be verified, services that do not speak TLS and requests that can't be sent at all are permanent,
+// network failures, timeouts and connections closed by the service are not.
+func permanentClientError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalidCertificate x509.CertificateInvalidError
+	var recordHeader tls.RecordHeaderError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalidCertificate) || errors.As(err, &recordHeader) {
+		return true
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(urlErr.Err, &netErr) || errors.Is(urlErr.Err, io.EOF) || errors.Is(urlErr.Err, io.ErrUnexpectedEOF) ||
+		errors.Is(urlErr.Err, context.Canceled) || errors.Is(urlErr.Err, context.DeadlineExceeded) {
+		return false
+	}
+	// Errors that do not come from the network, such as an unsupported scheme
+	return true
+}
+
+// readErrorBody returns the beginning of body, longer bodies are truncated to MaxErrorBodyLength bytes
+func readErrorBody(body io.Reader) string {
+	content, _ := ioutil.ReadAll(io.LimitReader(body, MaxErrorBodyLength+1))
+	if len(content) > MaxErrorBodyLength {
+		return string(bytes.TrimSpace(content[:MaxErrorBodyLength])) + "..."
+	}
+	return string(bytes.TrimSpace(content))
+}
+
+// drainAndClose reads what is left of body so its connection goes back to the pool
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrainLength))
+	body.Close()
+}
@@ -0,0 +1,335 @@
+// +build integration_tests unit_tests
+
+package httpservice
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/retry"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BodyMock records whether response body has been read until its end and closed
+type BodyMock struct {
+	reader *strings.Reader
+	Closed bool
+}
+
+func (bm *BodyMock) Read(p []byte) (int, error) {
+	return bm.reader.Read(p)
+}
+
+func (bm *BodyMock) Close() error {
+	bm.Closed = true
+	return nil
+}
+
+func (bm *BodyMock) Drained() bool {
+	return bm.reader.Len() == 0
+}
+
+type RoundTripperMock struct {
+	StatusCode int
+	Body       *BodyMock
+	RespErr    error
+}
+
+func (rtm *RoundTripperMock) RoundTrip(*http.Request) (*http.Response, error) {
+	if rtm.RespErr != nil {
+		return nil, rtm.RespErr
+	}
+	return &http.Response{StatusCode: rtm.StatusCode, Body: rtm.Body}, nil
+}
+
+func postTestJob(statusCode int, body string) (*BodyMock, error) {
+	bodyMock := &BodyMock{reader: strings.NewReader(body)}
+	client := http.Client{Transport: &RoundTripperMock{StatusCode: statusCode, Body: bodyMock}}
+
+	var job commontypes.Job
+	job.ID = "httpservice"
+	return bodyMock, PostJob(context.Background(), client, Endpoint{Service: "status", URL: "http://status"}, job)
+}
+
+func TestPostJobClosesBodyOnSuccess(t *testing.T) {
+
+	body, err := postTestJob(200, "stored")
+
+	if err != nil {
+		t.Errorf("PostJob should not fail, error was '%s'.", err.Error())
+	}
+	if !body.Drained() || !body.Closed {
+		t.Errorf("Response body should be drained and closed.")
+	}
+}
+
+func TestPostJobMetrics(t *testing.T) {
+
+	client := http.Client{Transport: &RoundTripperMock{StatusCode: 200, Body: &BodyMock{reader: strings.NewReader("")}}}
+	var job commontypes.Job
+	job.ID = "TestPostJobMetrics"
+	job.Type = commontypes.RecordInfoRetrieval
+
+	requests := testutil.ToFloat64(metrics.ServiceRequests.WithLabelValues("storage", "200", "recordinforetrieval"))
+	PostJob(context.Background(), client, Endpoint{Service: "storage", URL: "http://storage"}, job)
+
+	if testutil.ToFloat64(metrics.ServiceRequests.WithLabelValues("storage", "200", "recordinforetrieval")) != requests+1 {
+		t.Errorf("Call should be counted by service, status code and job type.")
+	}
+}
+
+func TestPostJobReturnsServiceError(t *testing.T) {
+
+	body, err := postTestJob(503, "  maintenance  \n")
+
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("PostJob should return an *Error, error was '%v'.", err)
+	}
+	if serviceErr.Service != "status" || serviceErr.URL != "http://status" || serviceErr.StatusCode != 503 || serviceErr.Body != "maintenance" {
+		t.Errorf("Error should describe failed call, it was %+v.", serviceErr)
+	}
+	requiredError := "status service at http://status answered with status code 503: maintenance"
+	if err.Error() != requiredError {
+		t.Errorf("Error should be \"%s\" but error was '%s'.", requiredError, err.Error())
+	}
+	if retry.IsPermanent(err) {
+		t.Errorf("Server errors should be retried.")
+	}
+	if !body.Drained() || !body.Closed {
+		t.Errorf("Response body should be drained and closed.")
+	}
+}
+
+func TestPostJobTruncatesBody(t *testing.T) {
+
+	body, err := postTestJob(400, strings.Repeat("a", 2*MaxErrorBodyLength))
+
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("PostJob should return an *Error, error was '%v'.", err)
+	}
+	if serviceErr.Body != strings.Repeat("a", MaxErrorBodyLength)+"..." {
+		t.Errorf("Error body should be truncated to %d bytes, it had %d.", MaxErrorBodyLength, len(serviceErr.Body))
+	}
+	if !retry.IsPermanent(err) {
+		t.Errorf("Client errors should not be retried.")
+	}
+	if !body.Drained() || !body.Closed {
+		t.Errorf("Response body should be drained and closed.")
+	}
+}
+
+func TestPostJobUnreachableService(t *testing.T) {
+
+	client := http.Client{Transport: &RoundTripperMock{RespErr: io.ErrUnexpectedEOF}}
+
+	var job commontypes.Job
+	err := PostJob(context.Background(), client, Endpoint{Service: "storage", URL: "http://storage"}, job)
+
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("PostJob should return an *Error, error was '%v'.", err)
+	}
+	if serviceErr.Service != "storage" || serviceErr.StatusCode != 0 {
+		t.Errorf("Error should describe failed call, it was %+v.", serviceErr)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Error should wrap transport error, error was '%s'.", err.Error())
+	}
+	if retry.IsPermanent(err) {
+		t.Errorf("Transport errors should be retried.")
+	}
+}
+
+func TestPostJobPermanentClientErrors(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var job commontypes.Job
+
+	// Service certificate is not signed by a trusted CA
+	err := PostJob(context.Background(), http.Client{}, Endpoint{Service: "status", URL: server.URL}, job)
+	if err == nil || !retry.IsPermanent(err) {
+		t.Errorf("Untrusted certificates should not be retried, error was '%v'.", err)
+	}
+
+	// Service does not speak TLS
+	plainServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plainServer.Close()
+	err = PostJob(context.Background(), http.Client{}, Endpoint{Service: "status", URL: strings.Replace(plainServer.URL, "http://", "https://", 1)}, job)
+	if err == nil || !retry.IsPermanent(err) {
+		t.Errorf("Services that do not speak TLS should not be retried, error was '%v'.", err)
+	}
+
+	// Request can't be sent at all
+	err = PostJob(context.Background(), http.Client{}, Endpoint{Service: "status", URL: "ftp://status"}, job)
+	if err == nil || !retry.IsPermanent(err) {
+		t.Errorf("Unsupported schemes should not be retried, error was '%v'.", err)
+	}
+}
+
+// HeadersRoundTripperMock keeps headers of the last request
+type HeadersRoundTripperMock struct {
+	Headers http.Header
+}
+
+func (hrtm *HeadersRoundTripperMock) RoundTrip(request *http.Request) (*http.Response, error) {
+	hrtm.Headers = request.Header
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestPostJobSendsCredentials(t *testing.T) {
+
+	transport := &HeadersRoundTripperMock{}
+	client := http.Client{Transport: transport}
+	var job commontypes.Job
+
+	PostJob(context.Background(), client, NewEndpoint("status", config.Service{URL: "https://status", Token: "secret"}), job)
+	if transport.Headers.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Token should be sent as a bearer token, Authorization header was '%s'.", transport.Headers.Get("Authorization"))
+	}
+
+	PostJob(context.Background(), client, NewEndpoint("status", config.Service{URL: "https://status", Username: "jobrouter", Password: "pass"}), job)
+	request := http.Request{Header: transport.Headers}
+	username, password, ok := request.BasicAuth()
+	if !ok || username != "jobrouter" || password != "pass" {
+		t.Errorf("Username and password should be sent using basic auth.")
+	}
+
+	PostJob(context.Background(), client, NewEndpoint("status", config.Service{Name: "status"}), job)
+	if transport.Headers.Get("Authorization") != "" {
+		t.Errorf("No credentials should be sent when they are not configured.")
+	}
+}
+
+func TestPostJobSendsTraceContext(t *testing.T) {
+
+	transport := &HeadersRoundTripperMock{}
+	client := http.Client{Transport: transport}
+	var job commontypes.Job
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, Remote: true}))
+
+	PostJob(ctx, client, NewEndpoint("status", config.Service{Name: "status"}), job)
+	if !strings.HasPrefix(transport.Headers.Get("traceparent"), "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Errorf("Trace context should be sent along with job, traceparent header was '%s'.", transport.Headers.Get("traceparent"))
+	}
+}
+
+func TestNewEndpointUsesNameWithoutURL(t *testing.T) {
+
+	endpoint := NewEndpoint("storage", config.Service{Name: "storage:8080"})
+	if endpoint.URL != "http://storage:8080" {
+		t.Errorf("Endpoint URL should be 'http://storage:8080', not '%s'.", endpoint.URL)
+	}
+
+	endpoint = NewEndpoint("storage", config.Service{Name: "storage:8080", URL: "https://storage.example.com/api/jobs"})
+	if endpoint.URL != "https://storage.example.com/api/jobs" {
+		t.Errorf("Endpoint URL should be 'https://storage.example.com/api/jobs', not '%s'.", endpoint.URL)
+	}
+}
+
+func TestNewClientTrustsCAFile(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	var job commontypes.Job
+	endpoint := Endpoint{Service: "status", URL: server.URL}
+
+	err := PostJob(context.Background(), http.Client{}, endpoint, job)
+	if err == nil {
+		t.Errorf("Services using unknown CAs should not be trusted by default.")
+	}
+
+	client, err := NewClient(config.Service{URL: server.URL, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewClient should not fail, error was '%s'.", err.Error())
+	}
+	err = PostJob(context.Background(), client, endpoint, job)
+	if err != nil {
+		t.Errorf("Services using configured CA should be trusted, error was '%s'.", err.Error())
+	}
+}
+
+func TestNewClientInvalidTLSFiles(t *testing.T) {
+
+	invalidFile := filepath.Join(t.TempDir(), "invalid.pem")
+	ioutil.WriteFile(invalidFile, []byte("not a certificate"), 0600)
+
+	_, err := NewClient(config.Service{CAFile: invalidFile})
+	if err == nil {
+		t.Errorf("NewClient should fail when CA file has no certificates.")
+	}
+
+	_, err = NewClient(config.Service{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	if err == nil {
+		t.Errorf("NewClient should fail when CA file does not exist.")
+	}
+
+	_, err = NewClient(config.Service{CertFile: invalidFile, KeyFile: invalidFile})
+	if err == nil {
+		t.Errorf("NewClient should fail when client certificate can't be loaded.")
+	}
+}
+
+func TestNewClientSettings(t *testing.T) {
+
+	client, err := NewClient(config.Service{})
+	if err != nil {
+		t.Fatalf("NewClient should not fail, error was '%s'.", err.Error())
+	}
+	transport := client.Transport.(*http.Transport)
+	if client.Timeout != DefaultTimeout || transport.MaxIdleConnsPerHost != DefaultMaxIdleConnections {
+		t.Errorf("Client should use default settings, timeout was %s and max idle connections %d.", client.Timeout, transport.MaxIdleConnsPerHost)
+	}
+
+	client, err = NewClient(config.Service{Timeout: time.Minute, MaxIdleConnections: 10, KeepAlive: time.Minute, Proxy: "http://proxy.example.com:3128"})
+	if err != nil {
+		t.Fatalf("NewClient should not fail, error was '%s'.", err.Error())
+	}
+	transport = client.Transport.(*http.Transport)
+	if client.Timeout != time.Minute || transport.MaxIdleConns != 10 || transport.MaxIdleConnsPerHost != 10 {
+		t.Errorf("Client should use configured settings, timeout was %s and max idle connections %d.", client.Timeout, transport.MaxIdleConnsPerHost)
+	}
+	request, _ := http.NewRequest(http.MethodPost, "https://storage.example.com", nil)
+	proxyURL, _ := transport.Proxy(request)
+	if proxyURL == nil || proxyURL.String() != "http://proxy.example.com:3128" {
+		t.Errorf("Client should use configured proxy, proxy was '%v'.", proxyURL)
+	}
+}
+
+func TestNewClientTimeout(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(config.Service{Timeout: 20 * time.Millisecond})
+	var job commontypes.Job
+	err := PostJob(context.Background(), client, Endpoint{Service: "storage", URL: server.URL}, job)
+	if err == nil || retry.IsPermanent(err) {
+		t.Errorf("Calls taking longer than timeout should fail and be retried.")
+	}
+}
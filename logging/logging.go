@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Routing outcomes, they are logged as outcome field so a job can be followed through JobRouter
+const (
+	// Received jobs have been read from jobmanager or wrapperoutput queues
+	Received = "received"
+	// Published jobs have been sent to a wrapper queue
+	Published = "published"
+	// Succeeded jobs have been reported to status Manager and stored
+	Succeeded = "succeeded"
+	// Failed jobs have been reported to status Manager as failed
+	Failed = "failed"
+	// DeadLettered jobs can't be routed, they are sent to dead letter queue
+	DeadLettered = "dead_lettered"
+	// Held jobs wait for a paused wrapper to be resumed
+	Held = "held"
+)
+
+// New creates the logger used by JobRouter, logConfig has already been validated by config package.
+// Empty settings mean info level and logfmt format.
+func New(logConfig config.Log) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	if level, err := logrus.ParseLevel(logConfig.Level); err == nil {
+		logger.SetLevel(level)
+	}
+	if logConfig.Format == config.JSONFormat {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		// Without colors text formatter writes logfmt
+		logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	}
+	return logger
+}
+
+// Discard creates a logger that writes nothing
+func Discard() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	return logger
+}
+
+// JobFields returns the fields that identify job in logs
+func JobFields(job commontypes.Job) logrus.Fields {
+	return logrus.Fields{
+		"job_id":          job.ID,
+		"job_type":        metrics.JobType(job.Type),
+		"last_origin":     job.LastOrigin,
+		"required_origin": job.RequiredOrigin,
+	}
+}
@@ -0,0 +1,68 @@
+// +build integration_tests unit_tests
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/config"
+)
+
+func testJob() commontypes.Job {
+	var job commontypes.Job
+	job.ID = "TestJob"
+	job.Type = commontypes.ArtistInfoRetrieval
+	job.LastOrigin = "JobManager"
+	job.RequiredOrigin = "first"
+	return job
+}
+
+func TestNewJSONFormat(t *testing.T) {
+
+	var output bytes.Buffer
+	logger := New(config.Log{Level: "info", Format: config.JSONFormat})
+	logger.SetOutput(&output)
+
+	logger.WithFields(JobFields(testJob())).Info("Test")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatalf("Output should be JSON, output was '%s'.", output.String())
+	}
+	if entry["job_id"] != "TestJob" || entry["job_type"] != "artistinforetrieval" || entry["last_origin"] != "JobManager" || entry["required_origin"] != "first" {
+		t.Errorf("Entry should contain job fields, entry was %+v.", entry)
+	}
+}
+
+func TestNewLogfmtFormat(t *testing.T) {
+
+	var output bytes.Buffer
+	logger := New(config.Log{Level: "info", Format: config.LogfmtFormat})
+	logger.SetOutput(&output)
+
+	logger.WithFields(JobFields(testJob())).Info("Test")
+
+	if !strings.Contains(output.String(), "job_id=TestJob") || !strings.Contains(output.String(), "level=info") {
+		t.Errorf("Output should be logfmt, output was '%s'.", output.String())
+	}
+}
+
+func TestNewLevel(t *testing.T) {
+
+	var output bytes.Buffer
+	logger := New(config.Log{Level: "warn"})
+	logger.SetOutput(&output)
+
+	logger.Info("Test")
+	if output.Len() != 0 {
+		t.Errorf("Entries below level should be discarded, output was '%s'.", output.String())
+	}
+	logger.Warn("Test")
+	if output.Len() == 0 {
+		t.Errorf("Entries with level should be written.")
+	}
+}
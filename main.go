@@ -1,41 +1,176 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
-	"net/http"
-	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/admin"
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/circuit"
 	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/health"
+	"github.com/a-castellano/music-manager-job-router/httpserver"
+	"github.com/a-castellano/music-manager-job-router/logging"
 	"github.com/a-castellano/music-manager-job-router/manager"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/outbox"
+	"github.com/a-castellano/music-manager-job-router/routing"
+	"github.com/a-castellano/music-manager-job-router/status"
+	"github.com/a-castellano/music-manager-job-router/storage"
+	"github.com/a-castellano/music-manager-job-router/tracing"
+	"github.com/a-castellano/music-manager-job-router/wrapperoutput"
 	"github.com/a-castellano/music-manager-job-router/wrappers"
+	"golang.org/x/sync/errgroup"
 )
 
-func main() {
+// readerPrefetch is the number of unacknowledged jobs each reader can have
+const readerPrefetch = 100
 
-	client := http.Client{
-		Timeout: time.Second * 5, // Maximum of 5 secs
+// newBrokers creates the broker connections used by jobmanager reader, wrapperoutput reader, router and admin API.
+// Each component uses its own connection, readers and router wait for publishing confirmations so jobs are only
+// acknowledged once the jobs or dead letters sent in their place are safe.
+// Jobs held for paused wrappers stay unacked, prefetch limits how many of them each reader can hold.
+func newBrokers(server config.Server) (jobManager, wrapperOutput, router, admin broker.Broker) {
+	if server.Type == config.MemoryBroker {
+		// Connections share the same in-memory queues
+		memory := broker.NewMemory()
+		return memory, memory.Connection(), memory.Connection(), memory.Connection()
 	}
+	return broker.NewConfirmSession(server, readerPrefetch), broker.NewConfirmSession(server, readerPrefetch), broker.NewConfirmSession(server, 0), broker.NewSession(server, 0)
+}
 
-	log.Println("Reading config.")
+func main() {
+
+	// Until config is read logs use default level and format
+	logger := logging.New(config.Log{})
+	logger.Info("Reading config.")
 
 	jobRouterConfig, err := config.ReadConfig()
 
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	} else {
-		log.Println("Config readed successfully.")
+		logger.Fatal(err)
+	}
+	logger = logging.New(jobRouterConfig.Log)
+	logger.Info("Config readed successfully.")
 
-		wrapperChannel := make(chan commontypes.Job)
-		go manager.ReadJobManagerJobs(jobRouterConfig, wrapperChannel)
-		jobRouterError := wrappers.RouteJobs(jobRouterConfig, wrapperChannel, client)
+	// log and file services and outbox dispatcher use standard logger, its lines are written as messages of logger
+	log.SetFlags(0)
+	log.SetOutput(logger.Writer())
 
-		if jobRouterError != nil {
-			fmt.Println(jobRouterError)
+	shutdownTracing, err := tracing.Setup(context.Background(), jobRouterConfig.Tracing)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	// Spans that have not been exported yet are sent before exiting
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracing.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error(err)
 		}
+	}()
+
+	statusReporter, err := status.New(jobRouterConfig.Status)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	resultStore, err := storage.New(jobRouterConfig.Storage)
+	if err != nil {
+		logger.Fatal(err)
 	}
 
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Every component is stopped when RouteJobs finishes, when a signal is received or when any of them fails
+	ctx, cancel := context.WithCancel(signalCtx)
+	defer cancel()
+	components, componentsCtx := errgroup.WithContext(ctx)
+
+	wrapperChannel := make(chan routing.Job)
+
+	// With an outbox router only writes notifications to disk, dispatcher delivers them to status and storage services
+	routerStatusReporter, routerResultStore := statusReporter, resultStore
+	if jobRouterConfig.Outbox.Directory != "" {
+		jobsOutbox, err := outbox.Open(jobRouterConfig.Outbox.Directory)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		routerStatusReporter, routerResultStore = jobsOutbox.Reporter(), jobsOutbox.ResultStore()
+		dispatcher := outbox.NewDispatcher(jobsOutbox, statusReporter, resultStore, jobRouterConfig.Outbox.RetryInterval)
+		components.Go(func() error {
+			return dispatcher.Run(componentsCtx)
+		})
+	}
+
+	jobManagerBroker, wrapperOutputBroker, routerBroker, adminBroker := newBrokers(jobRouterConfig.Server)
+	defer adminBroker.Close()
+
+	// Readers can be stopped through admin API while router keeps routing the jobs they have read
+	readersCtx, drain := context.WithCancel(componentsCtx)
+	defer drain()
+	pauses := routing.NewPauses()
+	decisions := routing.NewDecisions(jobRouterConfig.Admin.RecentDecisions)
+
+	// http endpoints are only served when http section is configured
+	if jobRouterConfig.HTTP.Address != "" {
+		checker := health.NewChecker(jobRouterConfig.HTTP.LivenessTimeout)
+		checker.AddReadinessCheck("jobmanager", health.Connected(jobManagerBroker))
+		checker.AddReadinessCheck("wrapperoutput", health.Connected(wrapperOutputBroker))
+		checker.AddReadinessCheck("router", health.Connected(routerBroker))
+		if protected, ok := statusReporter.(circuit.Protected); ok {
+			checker.AddReadinessCheck("status", health.BreakerClosed(protected.Breaker()))
+		}
+		if protected, ok := resultStore.(circuit.Protected); ok {
+			checker.AddReadinessCheck("storage", health.BreakerClosed(protected.Breaker()))
+		}
+
+		server := httpserver.New(jobRouterConfig.HTTP.Address)
+		server.Handle("/metrics", metrics.Handler())
+		server.Handle("/healthz", checker.LivenessHandler())
+		server.Handle("/readyz", checker.ReadinessHandler())
+		if jobRouterConfig.Admin.Token != "" {
+			adminAPI := admin.New(jobRouterConfig.Admin, jobRouterConfig.Wrappers, adminBroker, pauses, decisions, admin.Actions{Drain: drain, Shutdown: cancel}, logger)
+			server.Handle("/admin/", adminAPI.Handler())
+		}
+		components.Go(func() error {
+			return server.Run(componentsCtx)
+		})
+	}
+
+	components.Go(func() error {
+		defer jobManagerBroker.Close()
+		return manager.ReadJobManagerJobs(readersCtx, jobRouterConfig, jobManagerBroker, wrapperChannel, logger)
+	})
+	components.Go(func() error {
+		defer wrapperOutputBroker.Close()
+		return wrapperoutput.ReadWrapperOutputJobs(readersCtx, jobRouterConfig, wrapperOutputBroker, wrapperChannel, logger)
+	})
+	components.Go(func() error {
+		// RouteJobs finishes when a Die job is received, the other components must finish too
+		defer cancel()
+		defer routerBroker.Close()
+		return wrappers.RouteJobs(componentsCtx, jobRouterConfig, routerBroker, wrapperChannel, routerStatusReporter, routerResultStore, logger, pauses, decisions)
+	})
+
+	<-componentsCtx.Done()
+	if signalCtx.Err() != nil {
+		logger.Info("Signal received, shutting down.")
+	}
+
+	componentsDone := make(chan error, 1)
+	go func() { componentsDone <- components.Wait() }()
+
+	select {
+	case jobRouterError := <-componentsDone:
+		if jobRouterError != nil {
+			logger.Fatal(jobRouterError)
+		}
+		logger.Info("JobRouter stopped.")
+	case <-time.After(jobRouterConfig.ShutdownGracePeriod):
+		logger.Fatal("Grace period exceeded waiting for in flight jobs.")
+	}
 }
@@ -1,117 +1,43 @@
 package manager
 
 import (
-	"errors"
-	"fmt"
-	"strconv"
+	"context"
 
 	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
 	"github.com/a-castellano/music-manager-job-router/config"
-	"github.com/streadway/amqp"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/routing"
+	"github.com/sirupsen/logrus"
 )
 
-func ReadJobManagerJobs(config config.Config, wrapperChannel chan commontypes.Job) error {
-
-	connection_string := "amqp://" + config.Server.User + ":" + config.Server.Password + "@" + config.Server.Host + ":" + strconv.Itoa(config.Server.Port) + "/"
-	conn, err := amqp.Dial(connection_string)
-
-	if err != nil {
-		return fmt.Errorf("Failed to stablish connection with RabbitMQ: %w", err)
-	}
-	defer conn.Close()
-
-	jobmanager_ch, err := conn.Channel()
-	defer jobmanager_ch.Close()
-
-	if err != nil {
-		return fmt.Errorf("Failed to open jobmanager RabbitMQ channel: %w", err)
-	}
-
-	jobmanager_q, err := jobmanager_ch.QueueDeclare(
-		config.JobManager.Name,
-		true,  // Durable
-		false, // DeleteWhenUnused
-		false, // Exclusive
-		false, // NoWait
-		nil,   // arguments
-	)
-
-	if err != nil {
-		return fmt.Errorf("Failed to declare jobmanager queue: %w", err)
-	}
-
-	err = jobmanager_ch.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
-
-	if err != nil {
-		return fmt.Errorf("Failed to set jobmanager QoS: %w", err)
-	}
-
-	jobsToProcess, err := jobmanager_ch.Consume(
-		jobmanager_q.Name,
-		"",    // consumer
-		false, // auto-ack
-		false, // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,   // args
-	)
-
-	if err != nil {
-		return fmt.Errorf("Failed to register a consumer: %w", err)
-	}
-
-	processJobs := make(chan bool)
-
-	go func() {
-		for job := range jobsToProcess {
-
-			die := false
-			jobToProcess, decodeJobErr := commontypes.DecodeJob(job.Body)
-
-			if decodeJobErr != nil {
-				err = errors.New("Empty job data received.")
-			} else {
-				if jobToProcess.Type == commontypes.Die {
-					die = true
-				} else {
-					// This function  reads meesages from jobManager
-					if jobToProcess.LastOrigin != "JobManager" {
-						jobToProcess.Error = "LastOrigin can only be 'JobManager'"
-						jobToProcess.Status = false
-						job.Ack(false)
-						processJobs <- true
-						wrapperChannel <- jobToProcess
-					} else {
-						jobToProcess.LastOrigin = "JobRouter"
-						processJobs <- true
-						wrapperChannel <- jobToProcess
-					}
-				}
-			}
-			if die {
-				job.Ack(false)
-				processJobs <- false
-				for _, wrapper := range config.Wrappers {
-					jobToWrapper := jobToProcess
-					jobToWrapper.RequiredOrigin = wrapper.Name
-					wrapperChannel <- jobToWrapper
+// ReadJobManagerJobs sends jobs received from JobManager to wrapperChannel until ctx is cancelled or a Die job is received.
+// Before returning it waits until every job it has sent has been acknowledged.
+func ReadJobManagerJobs(ctx context.Context, config config.Config, jobBroker broker.Broker, wrapperChannel chan routing.Job, logger logrus.FieldLogger) error {
+
+	// No wrapper has processed new jobs yet
+	wrapperLabel := func(commontypes.Job) string { return "" }
+
+	return routing.ReadQueue(ctx, metrics.JobManagerSource, config.JobManager.Name, jobBroker, config.DeadLetter, logger, wrapperLabel, func(routedJob routing.Job) bool {
+		if routedJob.Job.Type == commontypes.Die {
+			routedJob.Done(routing.Routed)
+			for _, wrapper := range config.Wrappers {
+				jobToWrapper := routedJob.Job
+				jobToWrapper.RequiredOrigin = wrapper.Name
+				if !routing.Send(ctx, metrics.JobManagerSource, wrapperChannel, routing.NewJob(jobToWrapper, nil).WithContext(routedJob.Context())) {
+					return false
 				}
-				// Kill RouteJobs Function
-				jobToWrapperSender := jobToProcess
-				jobToWrapperSender.LastOrigin = "JobRouter"
-				jobToWrapperSender.RequiredOrigin = "JobRouter"
-				wrapperChannel <- jobToWrapperSender
-				return
 			}
+			// Kill RouteJobs Function
+			jobToWrapperSender := routedJob.Job
+			jobToWrapperSender.LastOrigin = "JobRouter"
+			jobToWrapperSender.RequiredOrigin = "JobRouter"
+			routing.Send(ctx, metrics.JobManagerSource, wrapperChannel, routing.NewJob(jobToWrapperSender, nil).WithContext(routedJob.Context()))
+			return false
 		}
-		return
-	}()
-
-	<-processJobs
 
-	return nil
+		// RouteJobs dead-letters jobs whose LastOrigin is not 'JobManager',
+		// delivery is acknowledged by RouteJobs once job has been routed
+		return routing.Send(ctx, metrics.JobManagerSource, wrapperChannel, routedJob)
+	})
 }
@@ -0,0 +1,256 @@
+// +build unit_tests
+
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/deadletter"
+	"github.com/a-castellano/music-manager-job-router/health"
+	"github.com/a-castellano/music-manager-job-router/logging"
+	"github.com/a-castellano/music-manager-job-router/routing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func memoryTestConfig() config.Config {
+	var testConfig config.Config
+
+	testConfig.JobManager.Name = "JobManager"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetter", Queue: "DeadLetter"}
+	testConfig.Wrappers = []config.Queue{{Name: "first"}, {Name: "second"}}
+	return testConfig
+}
+
+func publishToJobManager(memory *broker.Memory, testConfig config.Config, body []byte) {
+	memory.DeclareQueue(testConfig.JobManager.Name)
+	memory.Publish(context.Background(), testConfig.JobManager.Name, broker.Message{Body: body})
+}
+
+func TestMemoryRoutedJobIsAcked(t *testing.T) {
+
+	var job commontypes.Job
+
+	job.ID = "TestMemoryRoutedJobIsAcked"
+	job.Status = true
+	job.Type = commontypes.ArtistInfoRetrieval
+	job.LastOrigin = "JobManager"
+
+	encodedJob, _ := commontypes.EncodeJob(job)
+
+	testConfig := memoryTestConfig()
+	memory := broker.NewMemory()
+	defer memory.Close()
+	publishToJobManager(memory, testConfig, encodedJob)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wrapperChannel := make(chan routing.Job)
+	jobManagementDone := make(chan error)
+
+	go func() {
+		jobManagementDone <- ReadJobManagerJobs(ctx, testConfig, memory, wrapperChannel, logging.Discard())
+	}()
+
+	routedJob := <-wrapperChannel
+	if routedJob.Job.ID != job.ID {
+		t.Errorf("Received job ID should be '%s', not '%s'.", job.ID, routedJob.Job.ID)
+	}
+	routedJob.Done(routing.Routed)
+	cancel()
+
+	if err := <-jobManagementDone; err != nil {
+		t.Errorf("ReadJobManagerJobs should return no errors when it is stopped.")
+	}
+	if len(memory.Messages(testConfig.JobManager.Name)) != 0 {
+		t.Errorf("Routed job should have been removed from JobManager queue.")
+	}
+}
+
+func TestMemoryRequeuedJobIsKept(t *testing.T) {
+
+	var job commontypes.Job
+
+	job.ID = "TestMemoryRequeuedJobIsKept"
+	job.Status = true
+	job.Type = commontypes.ArtistInfoRetrieval
+	job.LastOrigin = "JobManager"
+
+	encodedJob, _ := commontypes.EncodeJob(job)
+
+	testConfig := memoryTestConfig()
+	memory := broker.NewMemory()
+	defer memory.Close()
+	publishToJobManager(memory, testConfig, encodedJob)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wrapperChannel := make(chan routing.Job)
+	jobManagementDone := make(chan error)
+
+	go func() {
+		jobManagementDone <- ReadJobManagerJobs(ctx, testConfig, memory, wrapperChannel, logging.Discard())
+	}()
+
+	routedJob := <-wrapperChannel
+	cancel()
+	routedJob.Done(routing.Requeued)
+
+	if err := <-jobManagementDone; err != nil {
+		t.Errorf("ReadJobManagerJobs should return no errors when it is stopped.")
+	}
+	if len(memory.Messages(testConfig.JobManager.Name)) != 1 {
+		t.Errorf("Requeued job should be kept in JobManager queue.")
+	}
+}
+
+func TestMemoryWaitingForRouterIsNotWedged(t *testing.T) {
+
+	var job commontypes.Job
+
+	job.ID = "TestMemoryWaitingForRouterIsNotWedged"
+	job.Status = true
+	job.Type = commontypes.ArtistInfoRetrieval
+	job.LastOrigin = "JobManager"
+
+	encodedJob, _ := commontypes.EncodeJob(job)
+
+	testConfig := memoryTestConfig()
+	memory := broker.NewMemory()
+	defer memory.Close()
+	publishToJobManager(memory, testConfig, encodedJob)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wrapperChannel := make(chan routing.Job)
+	jobManagementDone := make(chan error)
+
+	go func() {
+		jobManagementDone <- ReadJobManagerJobs(ctx, testConfig, memory, wrapperChannel, logging.Discard())
+	}()
+
+	// Nobody takes job from wrapperChannel
+	time.Sleep(50 * time.Millisecond)
+	if err := health.NewChecker(time.Millisecond).Live(); err != nil {
+		t.Errorf("Loop waiting for RouteJobs should not be wedged, error was '%s'.", err.Error())
+	}
+
+	routedJob := <-wrapperChannel
+	routedJob.Done(routing.Routed)
+	cancel()
+	<-jobManagementDone
+}
+
+func TestMemoryUndecodableJobIsDeadLettered(t *testing.T) {
+
+	testConfig := memoryTestConfig()
+	memory := broker.NewMemory()
+	defer memory.Close()
+	publishToJobManager(memory, testConfig, []byte("TestMemoryUndecodableJobIsDeadLettered"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wrapperChannel := make(chan routing.Job)
+	jobManagementDone := make(chan error)
+
+	go func() {
+		jobManagementDone <- ReadJobManagerJobs(ctx, testConfig, memory, wrapperChannel, logging.Discard())
+	}()
+
+	var deadLetters []broker.Message
+	for deadline := time.Now().Add(time.Second); len(deadLetters) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		deadLetters = memory.Messages(testConfig.DeadLetter.Queue)
+	}
+	cancel()
+
+	if err := <-jobManagementDone; err != nil {
+		t.Errorf("ReadJobManagerJobs should return no errors when it is stopped.")
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("Dead letter queue should have 1 message, not %d.", len(deadLetters))
+	}
+	if deadLetters[0].Headers[deadletter.ReasonHeader] != string(deadletter.DecodeError) {
+		t.Errorf("Dead letter reason should be '%s', not '%v'.", deadletter.DecodeError, deadLetters[0].Headers[deadletter.ReasonHeader])
+	}
+	if len(memory.Messages(testConfig.JobManager.Name)) != 0 {
+		t.Errorf("Dead-lettered message should have been removed from JobManager queue.")
+	}
+}
+
+func TestMemoryDieIsSentToEveryWrapper(t *testing.T) {
+
+	var job commontypes.Job
+
+	job.ID = "TestMemoryDieIsSentToEveryWrapper"
+	job.Status = true
+	job.Type = commontypes.Die
+	job.LastOrigin = "JobManager"
+
+	encodedJob, _ := commontypes.EncodeJob(job)
+
+	testConfig := memoryTestConfig()
+	memory := broker.NewMemory()
+	defer memory.Close()
+	publishToJobManager(memory, testConfig, encodedJob)
+
+	wrapperChannel := make(chan routing.Job)
+	jobManagementDone := make(chan error)
+
+	go func() {
+		jobManagementDone <- ReadJobManagerJobs(context.Background(), testConfig, memory, wrapperChannel, logging.Discard())
+	}()
+
+	for _, requiredOrigin := range []string{"first", "second", "JobRouter"} {
+		dieJob := (<-wrapperChannel).Job
+		if dieJob.Type != commontypes.Die || dieJob.RequiredOrigin != requiredOrigin {
+			t.Errorf("Die job should be sent to '%s', it was sent to '%s'.", requiredOrigin, dieJob.RequiredOrigin)
+		}
+	}
+
+	if err := <-jobManagementDone; err != nil {
+		t.Errorf("ReadJobManagerJobs should return no errors when die is processed.")
+	}
+}
+
+func TestMemoryTraceContextIsExtracted(t *testing.T) {
+
+	var job commontypes.Job
+
+	job.ID = "TestMemoryTraceContextIsExtracted"
+	job.Status = true
+	job.Type = commontypes.ArtistInfoRetrieval
+	job.LastOrigin = "JobManager"
+
+	encodedJob, _ := commontypes.EncodeJob(job)
+
+	testConfig := memoryTestConfig()
+	memory := broker.NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue(testConfig.JobManager.Name)
+	memory.Publish(context.Background(), testConfig.JobManager.Name, broker.Message{Body: encodedJob, Headers: map[string]interface{}{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wrapperChannel := make(chan routing.Job)
+	jobManagementDone := make(chan error)
+
+	go func() {
+		jobManagementDone <- ReadJobManagerJobs(ctx, testConfig, memory, wrapperChannel, logging.Discard())
+	}()
+
+	routedJob := <-wrapperChannel
+	spanContext := trace.SpanContextFromContext(routedJob.Context())
+	if spanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Routed job context should hold trace context received with job, span context was %+v.", spanContext)
+	}
+	routedJob.Done(routing.Routed)
+	cancel()
+	<-jobManagementDone
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"net/http"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Job sources used in JobsReceived
+const (
+	JobManagerSource    = "jobmanager"
+	WrapperOutputSource = "wrapperoutput"
+)
+
+// Job results used in JobsFinished
+const (
+	Succeeded = "success"
+	Failed    = "failed"
+)
+
+// Unknown is the job_type label of undecodable jobs and the wrapper label of jobs whose origin is not a configured wrapper
+const Unknown = "unknown"
+
+// Registry keeps every JobRouter metric, Go runtime and process metrics included
+var Registry = prometheus.NewRegistry()
+
+var (
+	// JobsReceived counts jobs read from jobmanager and wrapperoutput queues, wrapper is empty for jobs from jobmanager
+	JobsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobrouter_jobs_received_total",
+		Help: "Jobs received from jobmanager and wrapperoutput queues.",
+	}, []string{"source", "wrapper", "job_type"})
+
+	// JobsPublished counts jobs sent to each wrapper queue
+	JobsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobrouter_jobs_published_total",
+		Help: "Jobs published to wrapper queues.",
+	}, []string{"wrapper", "job_type"})
+
+	// JobFallbacks counts jobs sent to the next wrapper of their route after wrapper failed to process them
+	JobFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobrouter_job_fallbacks_total",
+		Help: "Jobs sent to the next wrapper of their route after a wrapper failed to process them.",
+	}, []string{"wrapper", "next_wrapper", "job_type"})
+
+	// JobsFinished counts finished jobs by result, wrapper is the last one that processed job and it is empty when no wrapper did
+	JobsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobrouter_jobs_finished_total",
+		Help: "Jobs finished successfully or failed.",
+	}, []string{"result", "wrapper", "job_type"})
+
+	// ServiceRequests counts calls to status and storage services by response status code, "error" means no response was received
+	ServiceRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobrouter_service_requests_total",
+		Help: "Calls to status and storage services by response status code.",
+	}, []string{"service", "code", "job_type"})
+
+	// ServiceRequestDuration observes how long calls to status and storage services take
+	ServiceRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jobrouter_service_request_duration_seconds",
+		Help:    "Time taken by calls to status and storage services.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "job_type"})
+
+	// Reconnections counts RabbitMQ reconnections after a connection or channel has been lost
+	Reconnections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jobrouter_amqp_reconnections_total",
+		Help: "RabbitMQ reconnections after a connection or channel has been lost.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		JobsReceived,
+		JobsPublished,
+		JobFallbacks,
+		JobsFinished,
+		ServiceRequests,
+		ServiceRequestDuration,
+		Reconnections,
+	)
+}
+
+// JobType returns the job_type label of jobType
+func JobType(jobType commontypes.JobType) string {
+	if jobType == commontypes.Die {
+		return "die"
+	}
+	return config.JobTypeName(jobType)
+}
+
+// Handler serves Registry metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
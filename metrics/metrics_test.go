@@ -0,0 +1,42 @@
+// +build integration_tests unit_tests
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+)
+
+func TestJobType(t *testing.T) {
+
+	if JobType(commontypes.ArtistInfoRetrieval) != "artistinforetrieval" {
+		t.Errorf("ArtistInfoRetrieval label should be 'artistinforetrieval', not '%s'.", JobType(commontypes.ArtistInfoRetrieval))
+	}
+	if JobType(commontypes.Die) != "die" {
+		t.Errorf("Die label should be 'die', not '%s'.", JobType(commontypes.Die))
+	}
+}
+
+func TestHandlerServesMetrics(t *testing.T) {
+
+	JobsReceived.WithLabelValues(JobManagerSource, "", "artistinforetrieval").Inc()
+	Reconnections.Inc()
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+
+	for _, metric := range []string{
+		`jobrouter_jobs_received_total{job_type="artistinforetrieval",source="jobmanager",wrapper=""}`,
+		"jobrouter_amqp_reconnections_total",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), metric) {
+			t.Errorf("Metrics should include %s.", metric)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/circuit"
+	"github.com/a-castellano/music-manager-job-router/retry"
+	"github.com/a-castellano/music-manager-job-router/status"
+	"github.com/a-castellano/music-manager-job-router/storage"
+	"github.com/a-castellano/music-manager-job-router/tracing"
+)
+
+const DefaultRetryInterval = 5 * time.Second
+
+// Dispatcher delivers outbox entries to status and storage services
+type Dispatcher struct {
+	outbox         *Outbox
+	statusReporter status.Reporter
+	resultStore    storage.ResultStore
+	retryInterval  time.Duration
+	// retryAt keeps when each unavailable service can be tried again
+	retryAt map[Kind]time.Time
+	now     func() time.Time
+}
+
+// NewDispatcher creates a Dispatcher, entries that can't be delivered are tried again every retryInterval
+func NewDispatcher(outbox *Outbox, statusReporter status.Reporter, resultStore storage.ResultStore, retryInterval time.Duration) *Dispatcher {
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+	return &Dispatcher{outbox: outbox, statusReporter: statusReporter, resultStore: resultStore, retryInterval: retryInterval, retryAt: make(map[Kind]time.Time), now: time.Now}
+}
+
+// Run delivers entries until ctx is cancelled, entries left are delivered next time JobRouter starts.
+// It only returns an error when outbox directory can't be used.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		err := d.Dispatch(ctx)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.outbox.Added():
+		case <-time.After(d.retryInterval):
+		}
+	}
+}
+
+// Dispatch delivers pending entries in order. Once the service of an entry is unavailable the remaining entries of its kind wait
+// so notifications sent to each service keep their order, entries of the other kind are still delivered.
+// An unavailable service is not tried again until retry interval has passed, even if entries are added meanwhile.
+// Entries rejected by their service are moved to the failed folder. Dispatch must not be called concurrently.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	unavailable := make(map[Kind]bool)
+	for kind, retryAt := range d.retryAt {
+		if d.now().Before(retryAt) {
+			unavailable[kind] = true
+		}
+	}
+	for _, entry := range d.outbox.Pending() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if unavailable[entry.Kind] {
+			continue
+		}
+		err := d.deliver(ctx, entry)
+		if err == nil {
+			delete(d.retryAt, entry.Kind)
+			if err := d.outbox.Remove(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		if !retry.IsPermanent(err) || errors.Is(err, circuit.ErrOpen) {
+			// Service is not available, remaining entries of this kind wait for next attempt
+			unavailable[entry.Kind] = true
+			d.retryAt[entry.Kind] = d.now().Add(d.retryInterval)
+			continue
+		}
+		log.Printf("Outbox entry %s for job %s has been rejected, it is moved to failed folder: %s", entry.Name, entry.Job.ID, err)
+		if err := d.outbox.Fail(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, entry Entry) error {
+	// Requests continue the trace of the job
+	ctx = tracing.Propagator.Extract(ctx, entry.Trace)
+	switch entry.Kind {
+	case Status:
+		return d.statusReporter.UpdateJobStatus(ctx, entry.Job)
+	case Storage:
+		return d.resultStore.StoreJobResult(ctx, entry.Job)
+	}
+	return retry.Permanent(fmt.Errorf("Unknown outbox entry kind '%s'.", entry.Kind))
+}
@@ -0,0 +1,246 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/tracing"
+)
+
+// Kind tells which service an entry has to be delivered to
+type Kind string
+
+const (
+	Status  Kind = "status"
+	Storage Kind = "storage"
+)
+
+const (
+	entrySuffix  = ".json"
+	tmpPrefix    = ".tmp-"
+	failedFolder = "failed"
+)
+
+// Entry is a notification waiting to be delivered, Trace keeps W3C trace context of the job
+type Entry struct {
+	Name  string                 `json:"-"`
+	Kind  Kind                   `json:"kind"`
+	Job   commontypes.Job        `json:"job"`
+	Trace tracing.HeadersCarrier `json:"trace,omitempty"`
+}
+
+// Outbox keeps notifications in a directory, one file per entry, until they are delivered.
+// Entries are written atomically and synced to disk so they survive crashes and restarts.
+// Directory is only read when outbox is opened, pending entries are kept in memory afterwards.
+type Outbox struct {
+	directory string
+	mutex     sync.Mutex
+	sequence  int
+	// entries are sorted by name, which is the order they were added
+	entries []Entry
+	added   chan struct{}
+}
+
+// Open creates directory if it does not exist, removes entries that were being written when JobRouter stopped
+// and loads pending entries. Entries that can't be decoded are moved to the failed folder.
+func Open(directory string) (*Outbox, error) {
+	err := os.MkdirAll(filepath.Join(directory, failedFolder), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create outbox directory: %w", err)
+	}
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read outbox directory: %w", err)
+	}
+
+	jobsOutbox := &Outbox{directory: directory, added: make(chan struct{}, 1)}
+	// ReadDir sorts files by name, which is the order entries were added
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), tmpPrefix) {
+			os.Remove(filepath.Join(directory, file.Name()))
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(file.Name(), entrySuffix) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(directory, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read outbox entry %s: %w", file.Name(), err)
+		}
+		var entry Entry
+		if err := json.Unmarshal(content, &entry); err != nil {
+			// Entry can't be delivered, it is kept apart for operators
+			if err := jobsOutbox.moveToFailed(file.Name()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry.Name = file.Name()
+		jobsOutbox.entries = append(jobsOutbox.entries, entry)
+	}
+	return jobsOutbox, nil
+}
+
+// Add stores a notification of kind for job with trace context of ctx, it returns once the entry is on disk
+func (o *Outbox) Add(ctx context.Context, kind Kind, job commontypes.Job) error {
+	trace := make(tracing.HeadersCarrier)
+	tracing.Propagator.Inject(ctx, trace)
+
+	entry := Entry{Kind: kind, Job: job, Trace: trace}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Failed to encode outbox entry: %w", err)
+	}
+
+	o.mutex.Lock()
+	o.sequence++
+	// Names sort in the order entries were added, also across restarts
+	name := fmt.Sprintf("%020d-%06d-%s%s", time.Now().UnixNano(), o.sequence, kind, entrySuffix)
+	o.mutex.Unlock()
+
+	err = writeFile(o.directory, name, content)
+	if err != nil {
+		return fmt.Errorf("Failed to write outbox entry: %w", err)
+	}
+
+	entry.Name = name
+	o.mutex.Lock()
+	// Entries added concurrently can be written in a different order than their names
+	position := sort.Search(len(o.entries), func(position int) bool { return o.entries[position].Name > name })
+	o.entries = append(o.entries, Entry{})
+	copy(o.entries[position+1:], o.entries[position:])
+	o.entries[position] = entry
+	o.mutex.Unlock()
+
+	select {
+	case o.added <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Added is notified every time an entry is added
+func (o *Outbox) Added() <-chan struct{} {
+	return o.added
+}
+
+// Pending returns entries waiting to be delivered in the order they were added
+func (o *Outbox) Pending() []Entry {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return append([]Entry{}, o.entries...)
+}
+
+// Remove deletes a delivered entry
+func (o *Outbox) Remove(entry Entry) error {
+	err := os.Remove(filepath.Join(o.directory, entry.Name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove outbox entry %s: %w", entry.Name, err)
+	}
+	o.forget(entry)
+	return nil
+}
+
+// Fail moves an entry that will never be delivered to the failed folder
+func (o *Outbox) Fail(entry Entry) error {
+	if err := o.moveToFailed(entry.Name); err != nil {
+		return err
+	}
+	o.forget(entry)
+	return nil
+}
+
+// forget removes entry from pending entries
+func (o *Outbox) forget(entry Entry) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	for position, pending := range o.entries {
+		if pending.Name == entry.Name {
+			o.entries = append(o.entries[:position], o.entries[position+1:]...)
+			return
+		}
+	}
+}
+
+func (o *Outbox) moveToFailed(name string) error {
+	err := os.Rename(filepath.Join(o.directory, name), filepath.Join(o.directory, failedFolder, name))
+	if err != nil {
+		return fmt.Errorf("Failed to move outbox entry %s to failed folder: %w", name, err)
+	}
+	return nil
+}
+
+// Reporter returns a status.Reporter that adds status notifications to outbox
+func (o *Outbox) Reporter() *Reporter {
+	return &Reporter{outbox: o}
+}
+
+// ResultStore returns a storage.ResultStore that adds storage notifications to outbox
+func (o *Outbox) ResultStore() *ResultStore {
+	return &ResultStore{outbox: o}
+}
+
+// Reporter adds job status to outbox instead of sending it to status Manager
+type Reporter struct {
+	outbox *Outbox
+}
+
+func (r *Reporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	return r.outbox.Add(ctx, Status, job)
+}
+
+// ResultStore adds job results to outbox instead of sending them to storage Manager
+type ResultStore struct {
+	outbox *Outbox
+}
+
+func (s *ResultStore) StoreJobResult(ctx context.Context, job commontypes.Job) error {
+	return s.outbox.Add(ctx, Storage, job)
+}
+
+// writeFile writes content to a temporary file which is renamed to name once it has been synced
+func writeFile(directory string, name string, content []byte) error {
+	file, err := ioutil.TempFile(directory, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	tmpName := file.Name()
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filepath.Join(directory, name))
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return syncDirectory(directory)
+}
+
+// syncDirectory makes renames inside directory durable
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,256 @@
+// +build integration_tests unit_tests
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/retry"
+	"github.com/a-castellano/music-manager-job-router/status"
+	"github.com/a-castellano/music-manager-job-router/storage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testJob(id string) commontypes.Job {
+	var job commontypes.Job
+	job.ID = id
+	job.Status = true
+	job.Finished = true
+	job.Type = commontypes.ArtistInfoRetrieval
+	job.LastOrigin = "first"
+	return job
+}
+
+func openTestOutbox(t *testing.T, directory string) *Outbox {
+	jobsOutbox, err := Open(directory)
+	if err != nil {
+		t.Fatalf("Open should not fail, error was '%s'.", err.Error())
+	}
+	return jobsOutbox
+}
+
+func TestEntriesSurviveReopening(t *testing.T) {
+
+	directory := t.TempDir()
+	jobsOutbox := openTestOutbox(t, directory)
+
+	jobsOutbox.Reporter().UpdateJobStatus(context.Background(), testJob("TestEntriesSurviveReopening"))
+	jobsOutbox.ResultStore().StoreJobResult(context.Background(), testJob("TestEntriesSurviveReopening"))
+
+	entries := openTestOutbox(t, directory).Pending()
+	if len(entries) != 2 {
+		t.Fatalf("Outbox should have 2 entries, not %d.", len(entries))
+	}
+	if entries[0].Kind != Status || entries[1].Kind != Storage {
+		t.Errorf("Entries should be kept in the order they were added, kinds were '%s' and '%s'.", entries[0].Kind, entries[1].Kind)
+	}
+	if entries[0].Job.ID != "TestEntriesSurviveReopening" || !entries[0].Job.Finished {
+		t.Errorf("Entry job should be kept, job was %+v.", entries[0].Job)
+	}
+}
+
+func TestOpenRemovesTemporaryFiles(t *testing.T) {
+
+	directory := t.TempDir()
+	ioutil.WriteFile(filepath.Join(directory, tmpPrefix+"unfinished"), []byte("{"), 0600)
+
+	openTestOutbox(t, directory)
+
+	if _, err := os.Stat(filepath.Join(directory, tmpPrefix+"unfinished")); !os.IsNotExist(err) {
+		t.Errorf("Open should remove entries that were not completely written.")
+	}
+}
+
+func TestOpenMovesCorruptedEntries(t *testing.T) {
+
+	directory := t.TempDir()
+	ioutil.WriteFile(filepath.Join(directory, "corrupted"+entrySuffix), []byte("{"), 0600)
+
+	entries := openTestOutbox(t, directory).Pending()
+	if len(entries) != 0 {
+		t.Errorf("Corrupted entries should not be returned.")
+	}
+	if _, err := os.Stat(filepath.Join(directory, failedFolder, "corrupted"+entrySuffix)); err != nil {
+		t.Errorf("Corrupted entries should be moved to failed folder.")
+	}
+}
+
+func TestDispatchDeliversEntries(t *testing.T) {
+
+	jobsOutbox := openTestOutbox(t, t.TempDir())
+	jobsOutbox.Add(context.Background(), Status, testJob("TestDispatchDeliversEntries"))
+	jobsOutbox.Add(context.Background(), Storage, testJob("TestDispatchDeliversEntries"))
+
+	statusReporter := &status.RecordingReporter{}
+	resultStore := &storage.RecordingResultStore{}
+	err := NewDispatcher(jobsOutbox, statusReporter, resultStore, time.Millisecond).Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch should not fail, error was '%s'.", err.Error())
+	}
+
+	if len(statusReporter.Jobs()) != 1 || len(resultStore.Jobs()) != 1 {
+		t.Errorf("Job should have been reported and stored once, reported %d times and stored %d times.", len(statusReporter.Jobs()), len(resultStore.Jobs()))
+	}
+	entries := jobsOutbox.Pending()
+	if len(entries) != 0 {
+		t.Errorf("Delivered entries should be removed, outbox has %d entries.", len(entries))
+	}
+}
+
+// countingReporter counts status updates, all of them fail with Err
+type countingReporter struct {
+	calls int
+	Err   error
+}
+
+func (r *countingReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	r.calls++
+	return r.Err
+}
+
+func TestDispatchWaitsRetryIntervalForUnavailableService(t *testing.T) {
+
+	jobsOutbox := openTestOutbox(t, t.TempDir())
+	jobsOutbox.Add(context.Background(), Status, testJob("TestDispatchWaitsRetryIntervalForUnavailableService"))
+
+	statusReporter := &countingReporter{Err: errors.New("Failed to update status.")}
+	dispatcher := NewDispatcher(jobsOutbox, statusReporter, &storage.RecordingResultStore{}, time.Minute)
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	dispatcher.Dispatch(context.Background())
+
+	// Entries added during the outage do not make dispatcher try the service again
+	for i := 0; i < 3; i++ {
+		jobsOutbox.Add(context.Background(), Status, testJob("TestDispatchWaitsRetryIntervalForUnavailableService"))
+		dispatcher.Dispatch(context.Background())
+	}
+	if statusReporter.calls != 1 {
+		t.Errorf("Unavailable service should be tried once per retry interval, it was tried %d times.", statusReporter.calls)
+	}
+
+	now = now.Add(time.Minute)
+	dispatcher.Dispatch(context.Background())
+	if statusReporter.calls != 2 {
+		t.Errorf("Unavailable service should be tried again once retry interval has passed, it was tried %d times.", statusReporter.calls)
+	}
+	if entries := jobsOutbox.Pending(); len(entries) != 4 {
+		t.Errorf("Undelivered entries should be kept, outbox has %d entries.", len(entries))
+	}
+}
+
+// spanReporter keeps span context of the last status update
+type spanReporter struct {
+	spanContext trace.SpanContext
+}
+
+func (r *spanReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	r.spanContext = trace.SpanContextFromContext(ctx)
+	return nil
+}
+
+func TestDispatchContinuesJobTrace(t *testing.T) {
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, Remote: true}))
+
+	directory := t.TempDir()
+	openTestOutbox(t, directory).Reporter().UpdateJobStatus(ctx, testJob("TestDispatchContinuesJobTrace"))
+
+	// Trace context has to survive restarts too
+	statusReporter := &spanReporter{}
+	NewDispatcher(openTestOutbox(t, directory), statusReporter, &storage.RecordingResultStore{}, time.Millisecond).Dispatch(context.Background())
+
+	if statusReporter.spanContext.TraceID() != traceID || statusReporter.spanContext.SpanID() != spanID {
+		t.Errorf("Delivered entries should continue the trace of the job, trace was '%s' and span '%s'.", statusReporter.spanContext.TraceID(), statusReporter.spanContext.SpanID())
+	}
+}
+
+func TestDispatchKeepsEntriesWhenServiceIsUnavailable(t *testing.T) {
+
+	jobsOutbox := openTestOutbox(t, t.TempDir())
+	jobsOutbox.Add(context.Background(), Status, testJob("TestDispatchKeepsEntriesWhenServiceIsUnavailableFirst"))
+	jobsOutbox.Add(context.Background(), Storage, testJob("TestDispatchKeepsEntriesWhenServiceIsUnavailableFirst"))
+	jobsOutbox.Add(context.Background(), Status, testJob("TestDispatchKeepsEntriesWhenServiceIsUnavailableSecond"))
+
+	statusReporter := &status.RecordingReporter{Err: errors.New("Failed to update status.")}
+	resultStore := &storage.RecordingResultStore{}
+	dispatcher := NewDispatcher(jobsOutbox, statusReporter, resultStore, time.Minute)
+	now := time.Now()
+	dispatcher.now = func() time.Time { return now }
+	dispatcher.Dispatch(context.Background())
+
+	if len(resultStore.Jobs()) != 1 {
+		t.Errorf("Entries of an available service should be delivered while the other service is unavailable.")
+	}
+	entries := jobsOutbox.Pending()
+	if len(entries) != 2 || entries[0].Kind != Status || entries[1].Kind != Status {
+		t.Fatalf("Undelivered entries should be kept, outbox has %d entries.", len(entries))
+	}
+
+	// Service is back, it is tried again once retry interval has passed
+	statusReporter.Err = nil
+	dispatcher.Dispatch(context.Background())
+	if len(statusReporter.Jobs()) != 0 {
+		t.Fatalf("Unavailable service should not be tried again before retry interval has passed.")
+	}
+	now = now.Add(time.Minute)
+	dispatcher.Dispatch(context.Background())
+	reported := statusReporter.Jobs()
+	if len(reported) != 2 || reported[0].ID != "TestDispatchKeepsEntriesWhenServiceIsUnavailableFirst" || reported[1].ID != "TestDispatchKeepsEntriesWhenServiceIsUnavailableSecond" {
+		t.Errorf("Kept entries should be delivered in order once service is back, reported jobs were %+v.", reported)
+	}
+}
+
+func TestDispatchMovesRejectedEntries(t *testing.T) {
+
+	directory := t.TempDir()
+	jobsOutbox := openTestOutbox(t, directory)
+	jobsOutbox.Add(context.Background(), Status, testJob("TestDispatchMovesRejectedEntries"))
+	jobsOutbox.Add(context.Background(), Storage, testJob("TestDispatchMovesRejectedEntries"))
+
+	statusReporter := &status.RecordingReporter{Err: retry.Permanent(errors.New("Failed to update status."))}
+	resultStore := &storage.RecordingResultStore{}
+	NewDispatcher(jobsOutbox, statusReporter, resultStore, time.Millisecond).Dispatch(context.Background())
+
+	if len(resultStore.Jobs()) != 1 {
+		t.Errorf("Entries after a rejected one should be delivered.")
+	}
+	failedEntries, _ := ioutil.ReadDir(filepath.Join(directory, failedFolder))
+	if len(failedEntries) != 1 {
+		t.Errorf("Rejected entry should be moved to failed folder, failed folder has %d entries.", len(failedEntries))
+	}
+}
+
+func TestRunDeliversAddedEntries(t *testing.T) {
+
+	jobsOutbox := openTestOutbox(t, t.TempDir())
+	statusReporter := &status.RecordingReporter{}
+	resultStore := &storage.RecordingResultStore{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatcherDone := make(chan error)
+	go func() {
+		dispatcherDone <- NewDispatcher(jobsOutbox, statusReporter, resultStore, time.Hour).Run(ctx)
+	}()
+
+	jobsOutbox.Add(context.Background(), Status, testJob("TestRunDeliversAddedEntries"))
+	for deadline := time.Now().Add(time.Second); len(statusReporter.Jobs()) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	if err := <-dispatcherDone; err != nil {
+		t.Errorf("Run should return no errors when it is stopped.")
+	}
+	if len(statusReporter.Jobs()) != 1 {
+		t.Errorf("Added entry should be delivered without waiting for retry interval.")
+	}
+}
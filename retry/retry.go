@@ -0,0 +1,85 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/backoff"
+)
+
+const (
+	DefaultRetries      = 3
+	DefaultInitialDelay = 500 * time.Millisecond
+	DefaultMaxDelay     = 5 * time.Second
+)
+
+// permanentError is an error that won't go away by trying again
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err has been marked as not retryable
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Policy decides how many times and how often a failed call is tried again, zero values mean default ones
+type Policy struct {
+	Retries      int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// Do runs call until it succeeds, it returns a permanent error, retries are exhausted or ctx is cancelled.
+// Delays between attempts grow exponentially with jitter.
+func (p Policy) Do(ctx context.Context, call func(ctx context.Context) error) error {
+	retries := p.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+	initialDelay := p.InitialDelay
+	if initialDelay <= 0 {
+		initialDelay = DefaultInitialDelay
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	delays := backoff.New(initialDelay, maxDelay)
+
+	for {
+		err := call(ctx)
+		if err == nil || IsPermanent(err) || delays.Attempts() >= retries {
+			return err
+		}
+		select {
+		case <-time.After(delays.Next()):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// RetryableHTTPStatus reports whether a request answered with statusCode may succeed if it is sent again
+func RetryableHTTPStatus(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+}
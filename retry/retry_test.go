@@ -0,0 +1,96 @@
+// +build integration_tests unit_tests
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{Retries: 3, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+
+	calls := 0
+	err := testPolicy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("Service unavailable.")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("Do should succeed once call succeeds, error was '%s'.", err.Error())
+	}
+	if calls != 3 {
+		t.Errorf("Call should have been made 3 times, not %d.", calls)
+	}
+}
+
+func TestDoGivesUpAfterRetries(t *testing.T) {
+
+	calls := 0
+	err := testPolicy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errors.New("Service unavailable.")
+	})
+
+	if err == nil {
+		t.Errorf("Do should fail when every call fails.")
+	}
+	if calls != 4 {
+		t.Errorf("Call should have been made 4 times, not %d.", calls)
+	}
+}
+
+func TestDoDoesNotRetryPermanentErrors(t *testing.T) {
+
+	calls := 0
+	permanentErr := errors.New("Bad request.")
+	err := testPolicy.Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return Permanent(permanentErr)
+	})
+
+	if !errors.Is(err, permanentErr) {
+		t.Errorf("Do should return call error.")
+	}
+	if !IsPermanent(err) {
+		t.Errorf("Returned error should still be permanent.")
+	}
+	if calls != 1 {
+		t.Errorf("Permanent errors should not be retried, call was made %d times.", calls)
+	}
+}
+
+func TestDoStopsWhenContextIsCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{Retries: 3, InitialDelay: time.Hour, MaxDelay: time.Hour}
+
+	calls := 0
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return errors.New("Service unavailable.")
+	})
+
+	if err == nil {
+		t.Errorf("Do should fail when it is cancelled.")
+	}
+	if calls != 1 {
+		t.Errorf("Call should not be retried after cancelling, call was made %d times.", calls)
+	}
+}
+
+func TestRetryableHTTPStatus(t *testing.T) {
+
+	for statusCode, retryable := range map[int]bool{500: true, 502: true, 503: true, 408: true, 429: true, 400: false, 401: false, 404: false} {
+		if RetryableHTTPStatus(statusCode) != retryable {
+			t.Errorf("RetryableHTTPStatus(%d) should be %t.", statusCode, retryable)
+		}
+	}
+}
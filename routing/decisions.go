@@ -0,0 +1,71 @@
+package routing
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRecentDecisions is how many routing decisions are kept when no size is configured
+const DefaultRecentDecisions = 100
+
+// Decision is the outcome of routing a job, Queue is where job has been sent and Decision why that wrapper has been chosen
+type Decision struct {
+	Time           time.Time `json:"time"`
+	JobID          string    `json:"job_id"`
+	JobType        string    `json:"job_type"`
+	LastOrigin     string    `json:"last_origin"`
+	RequiredOrigin string    `json:"required_origin"`
+	Outcome        string    `json:"outcome"`
+	Queue          string    `json:"queue,omitempty"`
+	Decision       string    `json:"decision,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Decisions keeps the last routing decisions
+type Decisions struct {
+	mutex     sync.Mutex
+	size      int
+	decisions []Decision
+	// next is the position overwritten by the next decision once decisions is full
+	next int
+}
+
+// NewDecisions creates Decisions that keeps size decisions, zero size means DefaultRecentDecisions
+func NewDecisions(size int) *Decisions {
+	if size <= 0 {
+		size = DefaultRecentDecisions
+	}
+	return &Decisions{size: size}
+}
+
+// Record keeps decision, the oldest one is dropped when Decisions is full.
+// Nil Decisions discard every decision.
+func (d *Decisions) Record(decision Decision) {
+	if d == nil {
+		return
+	}
+	if decision.Time.IsZero() {
+		decision.Time = time.Now()
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if len(d.decisions) < d.size {
+		d.decisions = append(d.decisions, decision)
+		return
+	}
+	d.decisions[d.next] = decision
+	d.next = (d.next + 1) % d.size
+}
+
+// Recent returns kept decisions from the oldest to the newest
+func (d *Decisions) Recent() []Decision {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	recent := make([]Decision, 0, len(d.decisions))
+	recent = append(recent, d.decisions[d.next:]...)
+	return append(recent, d.decisions[:d.next]...)
+}
@@ -0,0 +1,57 @@
+package routing
+
+import (
+	"sync"
+)
+
+// Pauses keeps the wrappers that routing to has been paused.
+// Routers skip paused wrappers, jobs that can only go to a paused wrapper wait until it is resumed.
+type Pauses struct {
+	mutex  sync.Mutex
+	paused map[string]bool
+	// resumed is closed and replaced every time a wrapper is resumed
+	resumed chan struct{}
+}
+
+// NewPauses creates Pauses with no paused wrappers
+func NewPauses() *Pauses {
+	return &Pauses{paused: make(map[string]bool), resumed: make(chan struct{})}
+}
+
+// Pause stops routing jobs to wrapper
+func (p *Pauses) Pause(wrapper string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.paused[wrapper] = true
+}
+
+// Resume routes jobs to wrapper again, jobs waiting for it are woken up
+func (p *Pauses) Resume(wrapper string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.paused[wrapper] {
+		return
+	}
+	delete(p.paused, wrapper)
+	close(p.resumed)
+	p.resumed = make(chan struct{})
+}
+
+// Paused reports whether routing to wrapper has been paused
+func (p *Pauses) Paused(wrapper string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.paused[wrapper]
+}
+
+// Resumed returns a channel that is closed the next time any wrapper is resumed,
+// it must be taken before checking Paused so no resume is missed
+func (p *Pauses) Resumed() <-chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.resumed
+}
@@ -0,0 +1,101 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/deadletter"
+	"github.com/a-castellano/music-manager-job-router/health"
+	"github.com/a-castellano/music-manager-job-router/logging"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// ReadQueue consumes queue and passes every job read to handle until ctx is cancelled or handle returns false, consuming again
+// when broker connection is lost. source names the reader in health checks and metrics, wrapperLabel returns the wrapper
+// metrics label of a job, undecodable jobs are passed as an empty job.
+// Jobs passed to handle carry their delivery, trace context and queue, undecodable ones are dead-lettered instead.
+// Before returning it waits until every job passed to handle has been acknowledged.
+func ReadQueue(ctx context.Context, source string, queue string, jobBroker broker.Broker, deadLetterConfig config.DeadLetter, logger logrus.FieldLogger, wrapperLabel func(commontypes.Job) string, handle func(Job) bool) error {
+
+	// Loop is busy while it processes a job, waiting for RouteJobs to take it is checked by RouteJobs liveness
+	defer health.Idle(source)
+
+	jobBroker.DeclareQueue(queue)
+	deadLetter := deadletter.New(jobBroker, deadLetterConfig)
+
+	// Broker can't be closed until jobs sent to RouteJobs have been acknowledged
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+
+	for {
+		deliveries, err := jobBroker.Consume(ctx, queue)
+
+		if ctx.Err() != nil {
+			// Cancelled while reconnecting
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to register a consumer: %w", err)
+		}
+
+		connected := true
+		for connected {
+			health.Idle(source)
+			var delivery broker.Delivery
+			select {
+			case <-ctx.Done():
+				jobBroker.Cancel()
+				return nil
+			case delivery, connected = <-deliveries:
+			}
+			if !connected {
+				// Connection has been lost, unacked jobs will be delivered again once broker has reconnected
+				break
+			}
+			health.Busy(source)
+
+			job, decodeJobErr := commontypes.DecodeJob(delivery.Body)
+
+			if decodeJobErr != nil {
+				// Undecodable data can't be routed, it is dead-lettered
+				metrics.JobsReceived.WithLabelValues(source, wrapperLabel(commontypes.Job{}), metrics.Unknown).Inc()
+				logger.WithFields(logrus.Fields{"outcome": logging.DeadLettered, "queue": queue, "error": decodeJobErr.Error()}).Error("Job can't be decoded, it is sent to dead letter queue.")
+				outcome := Routed
+				if deadLetter.Send(ctx, delivery.Body, deadletter.DecodeError, queue, "", decodeJobErr.Error()) != nil {
+					// Job is rejected instead, broker dead-letters it if its queue allows it
+					outcome = Rejected
+				}
+				NewJob(job, delivery).Done(outcome)
+				continue
+			}
+			metrics.JobsReceived.WithLabelValues(source, wrapperLabel(job), metrics.JobType(job.Type)).Inc()
+			logger.WithFields(logging.JobFields(job)).WithFields(logrus.Fields{"outcome": logging.Received, "queue": queue}).Debug("Job has been received.")
+			// Trace context sent along with job is kept so routing spans join its trace
+			jobCtx := tracing.Propagator.Extract(context.Background(), tracing.HeadersCarrier(delivery.Headers))
+
+			if !handle(NewJob(job, Track(delivery, &inFlight)).WithContext(jobCtx).WithSource(queue)) {
+				jobBroker.Cancel()
+				return nil
+			}
+		}
+	}
+}
+
+// Send sends job to RouteJobs through wrapperChannel, it returns false when ctx is cancelled before RouteJobs receives job,
+// job is requeued then. A router holding jobs for paused wrappers or busy with another job does not make source loop wedged.
+func Send(ctx context.Context, source string, wrapperChannel chan Job, job Job) bool {
+	health.Idle(source)
+	select {
+	case wrapperChannel <- job:
+		return true
+	case <-ctx.Done():
+		job.Done(Requeued)
+		return false
+	}
+}
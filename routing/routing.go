@@ -0,0 +1,130 @@
+package routing
+
+import (
+	"context"
+	"sync"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+)
+
+// Outcome is the result of routing a job, it decides what happens with the delivery job came from
+type Outcome int
+
+const (
+	// Routed jobs have been sent to a wrapper or to status Manager, their delivery is acknowledged
+	Routed Outcome = iota
+	// Requeued jobs couldn't be routed now, their delivery is returned to its queue
+	Requeued
+	// Rejected jobs can't be routed at all, their delivery is rejected and dead-lettered if its queue allows it
+	Rejected
+)
+
+// Acknowledger is implemented by broker.Delivery
+type Acknowledger interface {
+	Ack(multiple bool) error
+	Nack(multiple, requeue bool) error
+	Reject(requeue bool) error
+}
+
+// losable is implemented by deliveries that know whether the channel they came from has been closed
+type losable interface {
+	Lost() bool
+}
+
+// lost reports whether delivery can't be acknowledged anymore
+func lost(delivery Acknowledger) bool {
+	losable, ok := delivery.(losable)
+	return ok && losable.Lost()
+}
+
+// trackedDelivery marks itself as done in its WaitGroup once it has been acknowledged
+type trackedDelivery struct {
+	delivery Acknowledger
+	inFlight *sync.WaitGroup
+	once     sync.Once
+}
+
+// Track adds delivery to inFlight, it is marked as done when it is acked, nacked or rejected
+func Track(delivery Acknowledger, inFlight *sync.WaitGroup) Acknowledger {
+	inFlight.Add(1)
+	return &trackedDelivery{delivery: delivery, inFlight: inFlight}
+}
+
+func (t *trackedDelivery) Lost() bool {
+	return lost(t.delivery)
+}
+
+func (t *trackedDelivery) Ack(multiple bool) error {
+	defer t.once.Do(t.inFlight.Done)
+	return t.delivery.Ack(multiple)
+}
+
+func (t *trackedDelivery) Nack(multiple, requeue bool) error {
+	defer t.once.Do(t.inFlight.Done)
+	return t.delivery.Nack(multiple, requeue)
+}
+
+func (t *trackedDelivery) Reject(requeue bool) error {
+	defer t.once.Do(t.inFlight.Done)
+	return t.delivery.Reject(requeue)
+}
+
+// Job is a job waiting to be routed along with the delivery it came from, the queue it was read from and the trace context received with it
+type Job struct {
+	Job      commontypes.Job
+	delivery Acknowledger
+	ctx      context.Context
+	source   string
+}
+
+// NewJob wraps job, delivery can be nil for jobs created by JobRouter
+func NewJob(job commontypes.Job, delivery Acknowledger) Job {
+	return Job{Job: job, delivery: delivery}
+}
+
+// WithContext returns a copy of j that carries ctx, it holds trace context of job delivery
+func (j Job) WithContext(ctx context.Context) Job {
+	j.ctx = ctx
+	return j
+}
+
+// WithSource returns a copy of j read from queue, routers check job origin is allowed in that queue
+func (j Job) WithSource(queue string) Job {
+	j.source = queue
+	return j
+}
+
+// Source returns the queue job was read from, it is empty for jobs created by JobRouter
+func (j Job) Source() string {
+	return j.source
+}
+
+// Lost reports whether job delivery can't be acknowledged anymore because the channel it came from has been closed,
+// broker delivers job again then
+func (j Job) Lost() bool {
+	return lost(j.delivery)
+}
+
+// Context returns job context, jobs without one get a background context
+func (j Job) Context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// Done reports routing outcome to job delivery, it must be called once per job
+func (j Job) Done(outcome Outcome) {
+	if j.delivery == nil {
+		return
+	}
+	// Acknowledge errors mean channel has been closed, broker will deliver job again
+	switch outcome {
+	case Routed:
+		j.delivery.Ack(false)
+	case Requeued:
+		j.delivery.Nack(false, true)
+	case Rejected:
+		j.delivery.Reject(false)
+	}
+}
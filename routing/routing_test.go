@@ -0,0 +1,177 @@
+// +build integration_tests unit_tests
+
+package routing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+)
+
+type AcknowledgerMock struct {
+	Acked    int
+	Nacked   int
+	Requeued bool
+	Rejected int
+}
+
+func (am *AcknowledgerMock) Ack(multiple bool) error {
+	am.Acked++
+	return nil
+}
+
+func (am *AcknowledgerMock) Nack(multiple, requeue bool) error {
+	am.Nacked++
+	am.Requeued = requeue
+	return nil
+}
+
+func (am *AcknowledgerMock) Reject(requeue bool) error {
+	am.Rejected++
+	return nil
+}
+
+// LostAcknowledgerMock is a delivery whose channel has been closed
+type LostAcknowledgerMock struct {
+	AcknowledgerMock
+}
+
+func (am *LostAcknowledgerMock) Lost() bool {
+	return true
+}
+
+func TestLost(t *testing.T) {
+
+	var inFlight sync.WaitGroup
+
+	if NewJob(commontypes.Job{ID: "TestLost"}, nil).Lost() || NewJob(commontypes.Job{ID: "TestLost"}, &AcknowledgerMock{}).Lost() {
+		t.Errorf("Jobs whose delivery does not report its channel should not be lost.")
+	}
+	if !NewJob(commontypes.Job{ID: "TestLost"}, Track(&LostAcknowledgerMock{}, &inFlight)).Lost() {
+		t.Errorf("Tracked deliveries should report whether their channel has been closed.")
+	}
+}
+
+func TestDoneRouted(t *testing.T) {
+
+	delivery := &AcknowledgerMock{}
+	job := NewJob(commontypes.Job{ID: "TestDoneRouted"}, delivery)
+
+	job.Done(Routed)
+
+	if delivery.Acked != 1 || delivery.Nacked != 0 || delivery.Rejected != 0 {
+		t.Errorf("Routed jobs should only be acked, delivery was %+v.", *delivery)
+	}
+	if job.Job.ID != "TestDoneRouted" {
+		t.Errorf("Wrapped job ID should be 'TestDoneRouted', not '%s'.", job.Job.ID)
+	}
+}
+
+func TestDoneRequeued(t *testing.T) {
+
+	delivery := &AcknowledgerMock{}
+	job := NewJob(commontypes.Job{ID: "TestDoneRequeued"}, delivery)
+
+	job.Done(Requeued)
+
+	if delivery.Acked != 0 || delivery.Nacked != 1 || !delivery.Requeued || delivery.Rejected != 0 {
+		t.Errorf("Requeued jobs should only be nacked with requeue, delivery was %+v.", *delivery)
+	}
+}
+
+func TestDoneRejected(t *testing.T) {
+
+	delivery := &AcknowledgerMock{}
+	job := NewJob(commontypes.Job{ID: "TestDoneRejected"}, delivery)
+
+	job.Done(Rejected)
+
+	if delivery.Acked != 0 || delivery.Nacked != 0 || delivery.Rejected != 1 {
+		t.Errorf("Rejected jobs should only be rejected, delivery was %+v.", *delivery)
+	}
+}
+
+func TestDoneWithoutDelivery(t *testing.T) {
+
+	job := NewJob(commontypes.Job{ID: "TestDoneWithoutDelivery"}, nil)
+
+	// Jobs created by JobRouter have nothing to acknowledge
+	job.Done(Routed)
+}
+
+func TestTrackMarksDeliveryAsDone(t *testing.T) {
+
+	var inFlight sync.WaitGroup
+	delivery := &AcknowledgerMock{}
+
+	job := NewJob(commontypes.Job{ID: "TestTrackMarksDeliveryAsDone"}, Track(delivery, &inFlight))
+
+	waited := make(chan bool)
+	go func() {
+		inFlight.Wait()
+		waited <- true
+	}()
+
+	select {
+	case <-waited:
+		t.Fatalf("In flight jobs should be waited until they are acknowledged.")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	job.Done(Requeued)
+	// A second acknowledgement must not make WaitGroup counter negative
+	job.Done(Routed)
+
+	<-waited
+	if delivery.Nacked != 1 || delivery.Acked != 1 {
+		t.Errorf("Tracked delivery should be acknowledged as usual, delivery was %+v.", *delivery)
+	}
+}
+
+type contextKey struct{}
+
+func TestJobContext(t *testing.T) {
+
+	job := NewJob(commontypes.Job{ID: "TestJobContext"}, nil)
+	if job.Context() == nil {
+		t.Fatalf("Jobs without context should get a background one.")
+	}
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "TestJobContext")
+	if job.WithContext(ctx).Context().Value(contextKey{}) != "TestJobContext" {
+		t.Errorf("Job should carry the context it has been given.")
+	}
+	if job.Context().Value(contextKey{}) != nil {
+		t.Errorf("WithContext should not modify original job.")
+	}
+}
+
+func TestPauses(t *testing.T) {
+
+	pauses := NewPauses()
+	pauses.Pause("first")
+	if !pauses.Paused("first") || pauses.Paused("second") {
+		t.Errorf("Only 'first' should be paused.")
+	}
+
+	resumed := pauses.Resumed()
+	pauses.Resume("second")
+	select {
+	case <-resumed:
+		t.Errorf("Resuming a wrapper that is not paused should not wake anyone up.")
+	default:
+	}
+
+	pauses.Resume("first")
+	select {
+	case <-resumed:
+	default:
+		t.Errorf("Resuming a paused wrapper should close resumed channel.")
+	}
+	if pauses.Paused("first") {
+		t.Errorf("'first' should not be paused once it is resumed.")
+	}
+}
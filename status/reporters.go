@@ -0,0 +1,118 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/circuit"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/httpservice"
+	"github.com/a-castellano/music-manager-job-router/retry"
+)
+
+// New creates the Reporter selected by service type, http reporters get their own client and retry failed calls
+func New(service config.Service) (Reporter, error) {
+	switch service.Type {
+	case config.HTTPService:
+		policy := retry.Policy{Retries: service.Retries, InitialDelay: service.RetryInitialDelay, MaxDelay: service.RetryMaxDelay}
+		breaker := circuit.New(service.BreakerThreshold, service.BreakerTimeout)
+		client, err := httpservice.NewClient(service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to configure status service client: %w", err)
+		}
+		return NewRetryingReporter(NewHTTPReporter(client, httpservice.NewEndpoint("status", service)), policy, breaker), nil
+	case config.NoopService:
+		return NoopReporter{}, nil
+	case config.LogService:
+		return NewLogReporter(log.Default()), nil
+	case config.FileService:
+		return NewFileReporter(service.File)
+	}
+	return nil, fmt.Errorf("Unknown status service type '%s'.", service.Type)
+}
+
+// NoopReporter discards every job status
+type NoopReporter struct{}
+
+func (NoopReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	return nil
+}
+
+// LogReporter writes job status to a logger instead of sending it to status Manager
+type LogReporter struct {
+	logger *log.Logger
+}
+
+// NewLogReporter creates a Reporter that writes job status to logger
+func NewLogReporter(logger *log.Logger) *LogReporter {
+	return &LogReporter{logger: logger}
+}
+
+func (r *LogReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	r.logger.Printf("Job %s status: finished=%t status=%t last_origin=%s error=%q", job.ID, job.Finished, job.Status, job.LastOrigin, job.Error)
+	return nil
+}
+
+// FileReporter appends job status to a file, one JSON document per line
+type FileReporter struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileReporter creates a Reporter that appends job status to path, file is created if it does not exist
+func NewFileReporter(path string) (*FileReporter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open status file: %w", err)
+	}
+	return &FileReporter{file: file}, nil
+}
+
+func (r *FileReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	jsonJob, _ := json.Marshal(job)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, err := r.file.Write(append(jsonJob, '\n'))
+	if err != nil {
+		return fmt.Errorf("Failed to write job status to file: %w", err)
+	}
+	return nil
+}
+
+// Close closes status file
+func (r *FileReporter) Close() error {
+	return r.file.Close()
+}
+
+// RecordingReporter keeps every job status it receives in memory, Err is returned by UpdateJobStatus when it is set
+type RecordingReporter struct {
+	mutex sync.Mutex
+	jobs  []commontypes.Job
+	Err   error
+}
+
+func (r *RecordingReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.Err != nil {
+		return r.Err
+	}
+	r.jobs = append(r.jobs, job)
+	return nil
+}
+
+// Jobs returns recorded jobs in the order they were received
+func (r *RecordingReporter) Jobs() []commontypes.Job {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]commontypes.Job{}, r.jobs...)
+}
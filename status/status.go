@@ -1,29 +1,61 @@
 package status
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"net/http"
 
 	commontypes "github.com/a-castellano/music-manager-common-types/types"
-
-	"bytes"
+	"github.com/a-castellano/music-manager-job-router/circuit"
+	"github.com/a-castellano/music-manager-job-router/httpservice"
+	"github.com/a-castellano/music-manager-job-router/retry"
 )
 
+// Reporter sends job status to status Manager
+type Reporter interface {
+	UpdateJobStatus(ctx context.Context, job commontypes.Job) error
+}
+
+// HTTPReporter posts job status to status Manager service
+type HTTPReporter struct {
+	client   http.Client
+	endpoint httpservice.Endpoint
+}
+
+// NewHTTPReporter creates a Reporter that posts jobs to endpoint using client
+func NewHTTPReporter(client http.Client, endpoint httpservice.Endpoint) *HTTPReporter {
+	return &HTTPReporter{client: client, endpoint: endpoint}
+}
+
+func (r *HTTPReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	return httpservice.PostJob(ctx, r.client, r.endpoint, job)
+}
+
+// UpdateJobStatus posts job to statusService using client
 func UpdateJobStatus(client http.Client, statusService string, job commontypes.Job) error {
+	return NewHTTPReporter(client, httpservice.Endpoint{Service: "status", URL: "http://" + statusService}).UpdateJobStatus(context.Background(), job)
+}
 
-	jsonJob, _ := json.Marshal(job)
-	url := "http://" + statusService
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonJob))
+// RetryingReporter retries failed status updates and stops calling status Manager while it keeps failing
+type RetryingReporter struct {
+	reporter Reporter
+	policy   retry.Policy
+	breaker  *circuit.Breaker
+}
 
-	if err != nil {
-		return err
-	}
+// NewRetryingReporter wraps reporter, every attempt goes through breaker
+func NewRetryingReporter(reporter Reporter, policy retry.Policy, breaker *circuit.Breaker) *RetryingReporter {
+	return &RetryingReporter{reporter: reporter, policy: policy, breaker: breaker}
+}
 
-	if resp.StatusCode != 200 {
-		// We must include a reason for that error
-		return errors.New("Failed to update status.")
-	}
+func (r *RetryingReporter) UpdateJobStatus(ctx context.Context, job commontypes.Job) error {
+	return r.policy.Do(ctx, func(ctx context.Context) error {
+		return r.breaker.Call(ctx, func(ctx context.Context) error {
+			return r.reporter.UpdateJobStatus(ctx, job)
+		})
+	})
+}
 
-	return nil
+// Breaker returns the circuit breaker protecting status Manager
+func (r *RetryingReporter) Breaker() *circuit.Breaker {
+	return r.breaker
 }
@@ -1,29 +1,61 @@
 package storage
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"net/http"
 
 	commontypes "github.com/a-castellano/music-manager-common-types/types"
-
-	"bytes"
+	"github.com/a-castellano/music-manager-job-router/circuit"
+	"github.com/a-castellano/music-manager-job-router/httpservice"
+	"github.com/a-castellano/music-manager-job-router/retry"
 )
 
+// ResultStore keeps results of finished jobs
+type ResultStore interface {
+	StoreJobResult(ctx context.Context, job commontypes.Job) error
+}
+
+// HTTPResultStore posts job results to storage Manager service
+type HTTPResultStore struct {
+	client   http.Client
+	endpoint httpservice.Endpoint
+}
+
+// NewHTTPResultStore creates a ResultStore that posts jobs to endpoint using client
+func NewHTTPResultStore(client http.Client, endpoint httpservice.Endpoint) *HTTPResultStore {
+	return &HTTPResultStore{client: client, endpoint: endpoint}
+}
+
+func (s *HTTPResultStore) StoreJobResult(ctx context.Context, job commontypes.Job) error {
+	return httpservice.PostJob(ctx, s.client, s.endpoint, job)
+}
+
+// SendInfoToStorageManager posts job to storageService using client
 func SendInfoToStorageManager(client http.Client, storageService string, job commontypes.Job) error {
+	return NewHTTPResultStore(client, httpservice.Endpoint{Service: "storage", URL: "http://" + storageService}).StoreJobResult(context.Background(), job)
+}
 
-	jsonJob, _ := json.Marshal(job)
-	url := "http://" + storageService
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonJob))
+// RetryingResultStore retries failed job results and stops calling storage Manager while it keeps failing
+type RetryingResultStore struct {
+	store   ResultStore
+	policy  retry.Policy
+	breaker *circuit.Breaker
+}
 
-	if err != nil {
-		return err
-	}
+// NewRetryingResultStore wraps store, every attempt goes through breaker
+func NewRetryingResultStore(store ResultStore, policy retry.Policy, breaker *circuit.Breaker) *RetryingResultStore {
+	return &RetryingResultStore{store: store, policy: policy, breaker: breaker}
+}
 
-	if resp.StatusCode != 200 {
-		// We must include a reason for that error
-		return errors.New("Failed to update status.")
-	}
+func (s *RetryingResultStore) StoreJobResult(ctx context.Context, job commontypes.Job) error {
+	return s.policy.Do(ctx, func(ctx context.Context) error {
+		return s.breaker.Call(ctx, func(ctx context.Context) error {
+			return s.store.StoreJobResult(ctx, job)
+		})
+	})
+}
 
-	return nil
+// Breaker returns the circuit breaker protecting storage Manager
+func (s *RetryingResultStore) Breaker() *circuit.Breaker {
+	return s.breaker
 }
@@ -4,11 +4,22 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/circuit"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/httpservice"
+	"github.com/a-castellano/music-manager-job-router/retry"
 )
 
 type RoundTripperMock struct {
@@ -20,6 +31,18 @@ func (rtm *RoundTripperMock) RoundTrip(*http.Request) (*http.Response, error) {
 	return rtm.Response, rtm.RespErr
 }
 
+// SequenceRoundTripperMock answers each request with the next status code
+type SequenceRoundTripperMock struct {
+	StatusCodes []int
+	Requests    int
+}
+
+func (srtm *SequenceRoundTripperMock) RoundTrip(*http.Request) (*http.Response, error) {
+	statusCode := srtm.StatusCodes[srtm.Requests]
+	srtm.Requests++
+	return &http.Response{StatusCode: statusCode, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+}
+
 func TestSendJobToStorageFailedStatusCode(t *testing.T) {
 
 	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 500, Body: ioutil.NopCloser(bytes.NewBufferString(`
@@ -57,3 +80,169 @@ not html code
 		t.Errorf("TestSendJobToStorageSuccessStatusCode shouldn't fail.")
 	}
 }
+
+func TestNewStorageServices(t *testing.T) {
+
+	if _, ok := mustNew(t, config.Service{Type: config.HTTPService, Name: "Test"}).(*RetryingResultStore); !ok {
+		t.Errorf("http service should create a RetryingResultStore.")
+	}
+	if _, ok := mustNew(t, config.Service{Type: config.NoopService}).(NoopResultStore); !ok {
+		t.Errorf("noop service should create a NoopResultStore.")
+	}
+	if _, ok := mustNew(t, config.Service{Type: config.LogService}).(*LogResultStore); !ok {
+		t.Errorf("log service should create a LogResultStore.")
+	}
+	if _, err := New(config.Service{Type: "ftp"}); err == nil {
+		t.Errorf("Unknown service type should fail.")
+	}
+}
+
+func mustNew(t *testing.T, service config.Service) ResultStore {
+	created, err := New(service)
+	if err != nil {
+		t.Fatalf("New should not fail for %s services, error was '%s'.", service.Type, err.Error())
+	}
+	return created
+}
+
+func TestLogResultStore(t *testing.T) {
+
+	var output bytes.Buffer
+
+	var newJob commontypes.Job
+	newJob.ID = "TestLogResultStore"
+	newJob.Type = commontypes.RecordInfoRetrieval
+
+	err := NewLogResultStore(log.New(&output, "", 0)).StoreJobResult(context.Background(), newJob)
+	if err != nil {
+		t.Errorf("LogResultStore shouldn't fail.")
+	}
+	if !strings.Contains(output.String(), newJob.ID) {
+		t.Errorf("LogResultStore output should contain job ID, output was '%s'.", output.String())
+	}
+}
+
+func TestFileResultStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "storage.log")
+
+	var firstJob, secondJob commontypes.Job
+	firstJob.ID = "TestFileResultStoreFirst"
+	secondJob.ID = "TestFileResultStoreSecond"
+
+	fileResultStore, err := NewFileResultStore(path)
+	if err != nil {
+		t.Fatalf("NewFileResultStore shouldn't fail, error was '%s'.", err.Error())
+	}
+	fileResultStore.StoreJobResult(context.Background(), firstJob)
+	fileResultStore.StoreJobResult(context.Background(), secondJob)
+	fileResultStore.Close()
+
+	content, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("File should have 2 lines, not %d.", len(lines))
+	}
+	var writtenJob commontypes.Job
+	json.Unmarshal([]byte(lines[1]), &writtenJob)
+	if writtenJob.ID != secondJob.ID {
+		t.Errorf("Second line job ID should be '%s', not '%s'.", secondJob.ID, writtenJob.ID)
+	}
+}
+
+func TestRecordingResultStore(t *testing.T) {
+
+	var newJob commontypes.Job
+	newJob.ID = "TestRecordingResultStore"
+
+	recording := &RecordingResultStore{}
+	recording.StoreJobResult(context.Background(), newJob)
+	if len(recording.Jobs()) != 1 || recording.Jobs()[0].ID != newJob.ID {
+		t.Errorf("RecordingResultStore should have recorded job, recorded jobs were %+v.", recording.Jobs())
+	}
+
+	recording.Err = errors.New("Test")
+	if recording.StoreJobResult(context.Background(), newJob) == nil {
+		t.Errorf("RecordingResultStore should fail when Err is set.")
+	}
+	if len(recording.Jobs()) != 1 {
+		t.Errorf("Failed calls should not be recorded.")
+	}
+}
+
+func TestSendInfoToStorageManagerPermanentStatusCode(t *testing.T) {
+
+	client := http.Client{Transport: &SequenceRoundTripperMock{StatusCodes: []int{400}}}
+
+	var newJob commontypes.Job
+	newJob.ID = "sadasas2w21"
+
+	err := SendInfoToStorageManager(client, "Test", newJob)
+	if !retry.IsPermanent(err) {
+		t.Errorf("4xx status codes should return permanent errors.")
+	}
+
+	client = http.Client{Transport: &SequenceRoundTripperMock{StatusCodes: []int{503}}}
+	err = SendInfoToStorageManager(client, "Test", newJob)
+	if err == nil || retry.IsPermanent(err) {
+		t.Errorf("5xx status codes should return retryable errors.")
+	}
+}
+
+func TestSendInfoToStorageManagerErrorNamesService(t *testing.T) {
+
+	client := http.Client{Transport: &SequenceRoundTripperMock{StatusCodes: []int{404}}}
+
+	var newJob commontypes.Job
+	newJob.ID = "sadasas2w21"
+
+	err := SendInfoToStorageManager(client, "Test", newJob)
+	var serviceErr *httpservice.Error
+	if !errors.As(err, &serviceErr) {
+		t.Fatalf("Failed calls should return an *httpservice.Error, error was '%v'.", err)
+	}
+	if serviceErr.Service != "storage" || serviceErr.URL != "http://Test" || serviceErr.StatusCode != 404 {
+		t.Errorf("Error should describe failed call to storage service, it was %+v.", serviceErr)
+	}
+}
+
+func TestRetryingResultStoreRetriesServerErrors(t *testing.T) {
+
+	transport := &SequenceRoundTripperMock{StatusCodes: []int{503, 500, 200}}
+	client := http.Client{Transport: transport}
+	policy := retry.Policy{Retries: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	var newJob commontypes.Job
+	newJob.ID = "TestRetryingResultStoreRetriesServerErrors"
+
+	retrying := NewRetryingResultStore(NewHTTPResultStore(client, httpservice.Endpoint{Service: "storage", URL: "http://Test"}), policy, circuit.New(5, time.Minute))
+	err := retrying.StoreJobResult(context.Background(), newJob)
+	if err != nil {
+		t.Errorf("RetryingResultStore should succeed after retrying, error was '%s'.", err.Error())
+	}
+	if transport.Requests != 3 {
+		t.Errorf("3 requests should have been sent, not %d.", transport.Requests)
+	}
+}
+
+func TestRetryingResultStoreOpensBreaker(t *testing.T) {
+
+	transport := &SequenceRoundTripperMock{StatusCodes: []int{503, 503, 503}}
+	client := http.Client{Transport: transport}
+	policy := retry.Policy{Retries: 5, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	var newJob commontypes.Job
+	newJob.ID = "TestRetryingResultStoreOpensBreaker"
+
+	retrying := NewRetryingResultStore(NewHTTPResultStore(client, httpservice.Endpoint{Service: "storage", URL: "http://Test"}), policy, circuit.New(3, time.Minute))
+	err := retrying.StoreJobResult(context.Background(), newJob)
+	if !errors.Is(err, circuit.ErrOpen) {
+		t.Errorf("RetryingResultStore should stop retrying once breaker opens.")
+	}
+	if transport.Requests != 3 {
+		t.Errorf("3 requests should have been sent before opening breaker, not %d.", transport.Requests)
+	}
+	if retrying.Breaker().State() != circuit.Open {
+		t.Errorf("Breaker should be open, state is %s.", retrying.Breaker().State())
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/circuit"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/httpservice"
+	"github.com/a-castellano/music-manager-job-router/retry"
+)
+
+// New creates the ResultStore selected by service type, http stores get their own client and retry failed calls
+func New(service config.Service) (ResultStore, error) {
+	switch service.Type {
+	case config.HTTPService:
+		policy := retry.Policy{Retries: service.Retries, InitialDelay: service.RetryInitialDelay, MaxDelay: service.RetryMaxDelay}
+		breaker := circuit.New(service.BreakerThreshold, service.BreakerTimeout)
+		client, err := httpservice.NewClient(service)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to configure storage service client: %w", err)
+		}
+		return NewRetryingResultStore(NewHTTPResultStore(client, httpservice.NewEndpoint("storage", service)), policy, breaker), nil
+	case config.NoopService:
+		return NoopResultStore{}, nil
+	case config.LogService:
+		return NewLogResultStore(log.Default()), nil
+	case config.FileService:
+		return NewFileResultStore(service.File)
+	}
+	return nil, fmt.Errorf("Unknown storage service type '%s'.", service.Type)
+}
+
+// NoopResultStore discards every job result
+type NoopResultStore struct{}
+
+func (NoopResultStore) StoreJobResult(ctx context.Context, job commontypes.Job) error {
+	return nil
+}
+
+// LogResultStore writes job results to a logger instead of sending them to storage Manager
+type LogResultStore struct {
+	logger *log.Logger
+}
+
+// NewLogResultStore creates a ResultStore that writes job results to logger
+func NewLogResultStore(logger *log.Logger) *LogResultStore {
+	return &LogResultStore{logger: logger}
+}
+
+func (s *LogResultStore) StoreJobResult(ctx context.Context, job commontypes.Job) error {
+	s.logger.Printf("Job %s result: type=%s last_origin=%s", job.ID, config.JobTypeName(job.Type), job.LastOrigin)
+	return nil
+}
+
+// FileResultStore appends job results to a file, one JSON document per line
+type FileResultStore struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileResultStore creates a ResultStore that appends job results to path, file is created if it does not exist
+func NewFileResultStore(path string) (*FileResultStore, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open storage file: %w", err)
+	}
+	return &FileResultStore{file: file}, nil
+}
+
+func (s *FileResultStore) StoreJobResult(ctx context.Context, job commontypes.Job) error {
+	jsonJob, _ := json.Marshal(job)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err := s.file.Write(append(jsonJob, '\n'))
+	if err != nil {
+		return fmt.Errorf("Failed to write job result to file: %w", err)
+	}
+	return nil
+}
+
+// Close closes storage file
+func (s *FileResultStore) Close() error {
+	return s.file.Close()
+}
+
+// RecordingResultStore keeps every job result it receives in memory, Err is returned by StoreJobResult when it is set
+type RecordingResultStore struct {
+	mutex sync.Mutex
+	jobs  []commontypes.Job
+	Err   error
+}
+
+func (s *RecordingResultStore) StoreJobResult(ctx context.Context, job commontypes.Job) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+	s.jobs = append(s.jobs, job)
+	return nil
+}
+
+// Jobs returns recorded jobs in the order they were received
+func (s *RecordingResultStore) Jobs() []commontypes.Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]commontypes.Job{}, s.jobs...)
+}
@@ -0,0 +1,81 @@
+// +build integration_tests unit_tests
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and its key to directory
+func writeCertificate(t *testing.T, directory string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jobrouter"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	encodedKey, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := filepath.Join(directory, "cert.pem")
+	keyFile := filepath.Join(directory, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encodedKey}), 0600)
+	return certFile, keyFile
+}
+
+func TestNewWithoutFiles(t *testing.T) {
+
+	tlsConfig, err := New("", "", "")
+	if tlsConfig != nil || err != nil {
+		t.Errorf("New without files should return no config and no error.")
+	}
+}
+
+func TestNewLoadsFiles(t *testing.T) {
+
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+
+	tlsConfig, err := New(certFile, certFile, keyFile)
+	if err != nil {
+		t.Fatalf("New should not fail, error was '%s'.", err.Error())
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Errorf("CA file should replace system CAs.")
+	}
+	if len(tlsConfig.Certificates) != 1 {
+		t.Errorf("Client certificate should be loaded.")
+	}
+}
+
+func TestNewInvalidFiles(t *testing.T) {
+
+	directory := t.TempDir()
+	certFile, _ := writeCertificate(t, directory)
+
+	if _, err := New(filepath.Join(directory, "missing.pem"), "", ""); err == nil {
+		t.Errorf("New should fail when CA file does not exist.")
+	}
+	if _, err := New("", certFile, certFile); err == nil {
+		t.Errorf("New should fail when key file does not contain a key.")
+	}
+}
@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/a-castellano/music-manager-job-router/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ServiceName identifies JobRouter spans
+	ServiceName = "music-manager-job-router"
+	// ShutdownTimeout is how long JobRouter waits for pending spans to be exported when it stops
+	ShutdownTimeout = 5 * time.Second
+
+	instrumentationName = "github.com/a-castellano/music-manager-job-router"
+)
+
+// Propagator reads and writes W3C trace context, it is used for AMQP headers and http requests
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// HeadersCarrier lets Propagator use AMQP message headers
+type HeadersCarrier map[string]interface{}
+
+// Get returns the value of key, headers that are not strings are ignored
+func (h HeadersCarrier) Get(key string) string {
+	value, _ := h[key].(string)
+	return value
+}
+
+// Set stores value under key
+func (h HeadersCarrier) Set(key string, value string) {
+	h[key] = value
+}
+
+// Keys lists header keys
+func (h HeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Setup exports spans as tracingConfig says, returned function exports pending spans and stops exporting.
+// When no exporter is defined spans are not recorded, trace context received from upstream is propagated anyway.
+func Setup(ctx context.Context, tracingConfig config.Tracing) (func(context.Context) error, error) {
+
+	otel.SetTextMapPropagator(Propagator)
+
+	var exporter sdktrace.SpanExporter
+	var closeExporter func() error
+	switch tracingConfig.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case config.OTLPExporter:
+		options := []otlptracehttp.Option{}
+		if tracingConfig.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(tracingConfig.Endpoint))
+		}
+		if tracingConfig.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		otlpExporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create otlp trace exporter: %w", err)
+		}
+		exporter = otlpExporter
+	case config.FileExporter:
+		file, err := os.OpenFile(tracingConfig.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open traces file: %w", err)
+		}
+		fileExporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Failed to create file trace exporter: %w", err)
+		}
+		exporter, closeExporter = fileExporter, file.Close
+	default:
+		return nil, fmt.Errorf("Unknown trace exporter %s.", tracingConfig.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tracingConfig.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeExporter != nil {
+			if closeErr := closeExporter(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to export pending spans: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// Tracer returns the tracer JobRouter spans are started with
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// End records err in span, when there is one, and ends span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
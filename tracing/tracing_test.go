@@ -0,0 +1,80 @@
+// +build integration_tests unit_tests
+
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/a-castellano/music-manager-job-router/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// remoteContext returns a context holding a sampled span started by another service
+func remoteContext() context.Context {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+}
+
+func TestHeadersCarrierPropagatesTraceContext(t *testing.T) {
+
+	headers := map[string]interface{}{"x-jobrouter-job-id": "TestHeadersCarrierPropagatesTraceContext"}
+	Propagator.Inject(remoteContext(), HeadersCarrier(headers))
+
+	if headers["traceparent"] != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("traceparent header should be set, headers were %+v.", headers)
+	}
+
+	spanContext := trace.SpanContextFromContext(Propagator.Extract(context.Background(), HeadersCarrier(headers)))
+	if spanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !spanContext.IsRemote() {
+		t.Errorf("Extracted span context should belong to injected trace, it was %+v.", spanContext)
+	}
+}
+
+func TestHeadersCarrierIgnoresMissingHeaders(t *testing.T) {
+
+	spanContext := trace.SpanContextFromContext(Propagator.Extract(context.Background(), HeadersCarrier(nil)))
+	if spanContext.IsValid() {
+		t.Errorf("Messages without trace context should not start a trace.")
+	}
+}
+
+func TestSetupWithoutExporter(t *testing.T) {
+
+	shutdown, err := Setup(context.Background(), config.Tracing{})
+	if err != nil {
+		t.Fatalf("Setup without exporter should not fail, error was '%s'.", err.Error())
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown without exporter should not fail, error was '%s'.", err.Error())
+	}
+}
+
+func TestSetupFileExporter(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporter: config.FileExporter, File: path, SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("Setup with file exporter should not fail, error was '%s'.", err.Error())
+	}
+
+	_, span := Tracer().Start(remoteContext(), "TestSetupFileExporter")
+	End(span, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown should not fail, error was '%s'.", err.Error())
+	}
+
+	content, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(content), "TestSetupFileExporter") || !strings.Contains(string(content), "4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("Span should be written to file in its parent trace, file was '%s'.", string(content))
+	}
+}
@@ -0,0 +1,62 @@
+// +build unit_tests
+
+package wrapperoutput
+
+import (
+	"context"
+	"testing"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/logging"
+	"github.com/a-castellano/music-manager-job-router/routing"
+)
+
+func TestMemoryReceiveJobFromUnknownWrapper(t *testing.T) {
+
+	var testConfig config.Config
+
+	testConfig.WrapperOutput.Name = "WrapperOutput"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetter", Queue: "DeadLetter"}
+	testConfig.Wrappers = []config.Queue{{Name: "first"}}
+
+	var job commontypes.Job
+
+	job.ID = "TestMemoryReceiveJobFromUnknownWrapper"
+	job.Status = true
+	job.Finished = true
+	job.Type = commontypes.ArtistInfoRetrieval
+	job.LastOrigin = "second"
+
+	encodedJob, _ := commontypes.EncodeJob(job)
+
+	memory := broker.NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue(testConfig.WrapperOutput.Name)
+	memory.Publish(context.Background(), testConfig.WrapperOutput.Name, broker.Message{Body: encodedJob})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wrapperChannel := make(chan routing.Job)
+	wrapperOutputDone := make(chan error)
+
+	go func() {
+		wrapperOutputDone <- ReadWrapperOutputJobs(ctx, testConfig, memory, wrapperChannel, logging.Discard())
+	}()
+
+	routedJob := <-wrapperChannel
+	routedJob.Done(routing.Routed)
+	cancel()
+
+	if err := <-wrapperOutputDone; err != nil {
+		t.Errorf("ReadWrapperOutputJobs should return no errors when it is stopped.")
+	}
+	// RouteJobs dead-letters jobs from unknown wrappers
+	if routedJob.Job.LastOrigin != job.LastOrigin || routedJob.Source() != testConfig.WrapperOutput.Name {
+		t.Errorf("Job should be sent to RouteJobs along with the queue it was read from, source was '%s'.", routedJob.Source())
+	}
+	if len(memory.Messages(testConfig.WrapperOutput.Name)) != 0 {
+		t.Errorf("Routed job should have been removed from WrapperOutput queue.")
+	}
+}
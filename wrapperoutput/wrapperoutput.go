@@ -0,0 +1,35 @@
+package wrapperoutput
+
+import (
+	"context"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/routing"
+	"github.com/sirupsen/logrus"
+)
+
+// ReadWrapperOutputJobs sends jobs received from wrappers to wrapperChannel until ctx is cancelled.
+// Before returning it waits until every job it has sent has been acknowledged.
+func ReadWrapperOutputJobs(ctx context.Context, config config.Config, jobBroker broker.Broker, wrapperChannel chan routing.Job, logger logrus.FieldLogger) error {
+
+	// Only configured wrappers are used as metrics labels so unknown origins do not create new series
+	wrapperNames := make(map[string]bool)
+	for _, wrapper := range config.Wrappers {
+		wrapperNames[wrapper.Name] = true
+	}
+	wrapperLabel := func(job commontypes.Job) string {
+		if wrapperNames[job.LastOrigin] {
+			return job.LastOrigin
+		}
+		return metrics.Unknown
+	}
+
+	return routing.ReadQueue(ctx, metrics.WrapperOutputSource, config.WrapperOutput.Name, jobBroker, config.DeadLetter, logger, wrapperLabel, func(routedJob routing.Job) bool {
+		// RouteJobs dead-letters jobs whose LastOrigin is not a configured wrapper,
+		// delivery is acknowledged by RouteJobs once job has been routed
+		return routing.Send(ctx, metrics.WrapperOutputSource, wrapperChannel, routedJob)
+	})
+}
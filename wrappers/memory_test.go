@@ -0,0 +1,615 @@
+// +build unit_tests
+
+package wrappers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
+	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/deadletter"
+	"github.com/a-castellano/music-manager-job-router/logging"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/routing"
+	"github.com/a-castellano/music-manager-job-router/status"
+	"github.com/a-castellano/music-manager-job-router/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func memoryTestConfig() config.Config {
+	var testConfig config.Config
+
+	testConfig.JobManager.Name = "JobManager"
+	testConfig.WrapperOutput.Name = "WrapperOutput"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetter", Queue: "DeadLetter"}
+	testConfig.Wrappers = []config.Queue{{Name: "first"}, {Name: "second"}}
+	return testConfig
+}
+
+// routeWithMemoryBroker routes jobs followed by a Die job using an in-memory broker
+func routeWithMemoryBroker(t *testing.T, testConfig config.Config, statusReporter status.Reporter, resultStore storage.ResultStore, jobs ...routing.Job) *broker.Memory {
+	return routeWith(t, testConfig, statusReporter, resultStore, logging.Discard(), routing.NewPauses(), nil, jobs...)
+}
+
+// routeWith routes jobs like routeWithMemoryBroker writing routing decisions to logger and decisions and skipping wrappers paused in pauses
+func routeWith(t *testing.T, testConfig config.Config, statusReporter status.Reporter, resultStore storage.ResultStore, logger logrus.FieldLogger, pauses *routing.Pauses, decisions *routing.Decisions, jobs ...routing.Job) *broker.Memory {
+	memory := broker.NewMemory()
+	routeOn(t, memory, testConfig, statusReporter, resultStore, logger, pauses, decisions, jobs...)
+	return memory
+}
+
+// routeOn routes jobs like routeWith using memory
+func routeOn(t *testing.T, memory *broker.Memory, testConfig config.Config, statusReporter status.Reporter, resultStore storage.ResultStore, logger logrus.FieldLogger, pauses *routing.Pauses, decisions *routing.Decisions, jobs ...routing.Job) {
+	var dieJob commontypes.Job
+
+	dieJob.Status = true
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "JobRouter"
+	dieJob.RequiredOrigin = "JobRouter"
+
+	wrapperChannel := make(chan routing.Job)
+
+	go func() {
+		for _, job := range jobs {
+			wrapperChannel <- job
+		}
+		wrapperChannel <- routing.NewJob(dieJob, nil)
+	}()
+
+	err := RouteJobs(context.Background(), testConfig, memory, wrapperChannel, statusReporter, resultStore, logger, pauses, decisions)
+	if err != nil {
+		t.Fatalf("RouteJobs should return no errors, error was '%s'.", err.Error())
+	}
+}
+
+func decodeQueueJobs(t *testing.T, memory *broker.Memory, queue string) []commontypes.Job {
+	var jobs []commontypes.Job
+	for _, message := range memory.Messages(queue) {
+		job, err := commontypes.DecodeJob(message.Body)
+		if err != nil {
+			t.Fatalf("Jobs in queue %s should be decodable.", queue)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func TestMemoryNewJobIsSentToFirstWrapper(t *testing.T) {
+
+	var newJob commontypes.Job
+
+	newJob.ID = "TestMemoryNewJobIsSentToFirstWrapper"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	delivery := &AcknowledgerMock{}
+	memory := routeWithMemoryBroker(t, memoryTestConfig(), &status.RecordingReporter{}, &storage.RecordingResultStore{}, routing.NewJob(newJob, delivery))
+
+	firstWrapperJobs := decodeQueueJobs(t, memory, "first")
+	if len(firstWrapperJobs) != 1 || firstWrapperJobs[0].ID != newJob.ID {
+		t.Fatalf("New job should have been sent to first wrapper, first wrapper queue has %d jobs.", len(firstWrapperJobs))
+	}
+	if len(memory.Messages("second")) != 0 {
+		t.Errorf("New job should not have been sent to second wrapper.")
+	}
+	if delivery.Acked != 1 {
+		t.Errorf("New job delivery should be acked once it has been routed, delivery was %+v.", *delivery)
+	}
+}
+
+func TestMemoryFailedJobIsSentToNextWrapper(t *testing.T) {
+
+	var failedJob commontypes.Job
+
+	failedJob.ID = "TestMemoryFailedJobIsSentToNextWrapper"
+	failedJob.Status = false
+	failedJob.Type = commontypes.ArtistInfoRetrieval
+	failedJob.LastOrigin = "first"
+
+	memory := routeWithMemoryBroker(t, memoryTestConfig(), &status.RecordingReporter{}, &storage.RecordingResultStore{}, routing.NewJob(failedJob, nil))
+
+	secondWrapperJobs := decodeQueueJobs(t, memory, "second")
+	if len(secondWrapperJobs) != 1 || secondWrapperJobs[0].ID != failedJob.ID {
+		t.Fatalf("Failed job should have been sent to second wrapper, second wrapper queue has %d jobs.", len(secondWrapperJobs))
+	}
+	if len(memory.Messages("first")) != 0 {
+		t.Errorf("Failed job should not have been sent to first wrapper again.")
+	}
+}
+
+func TestMemoryUnknownRequiredOriginIsDeadLettered(t *testing.T) {
+
+	var unroutableJob commontypes.Job
+
+	unroutableJob.ID = "TestMemoryUnknownRequiredOriginIsDeadLettered"
+	unroutableJob.Status = true
+	unroutableJob.Type = commontypes.ArtistInfoRetrieval
+	unroutableJob.LastOrigin = "JobManager"
+	unroutableJob.RequiredOrigin = "third"
+
+	testConfig := memoryTestConfig()
+	delivery := &AcknowledgerMock{}
+	memory := routeWithMemoryBroker(t, testConfig, &status.RecordingReporter{}, &storage.RecordingResultStore{}, routing.NewJob(unroutableJob, delivery))
+
+	deadLetters := memory.Messages(testConfig.DeadLetter.Queue)
+	if len(deadLetters) != 1 {
+		t.Fatalf("Dead letter queue should have 1 message, not %d.", len(deadLetters))
+	}
+	if deadLetters[0].Headers[deadletter.ReasonHeader] != string(deadletter.UnknownWrapper) {
+		t.Errorf("Dead letter reason should be '%s', not '%v'.", deadletter.UnknownWrapper, deadLetters[0].Headers[deadletter.ReasonHeader])
+	}
+	if deadLetters[0].Headers[deadletter.SourceQueueHeader] != testConfig.JobManager.Name {
+		t.Errorf("Dead letter source queue should be '%s', not '%v'.", testConfig.JobManager.Name, deadLetters[0].Headers[deadletter.SourceQueueHeader])
+	}
+	if delivery.Acked != 1 {
+		t.Errorf("Dead-lettered job delivery should be acked, delivery was %+v.", *delivery)
+	}
+}
+
+func TestMemoryInvalidOriginIsDeadLettered(t *testing.T) {
+
+	var managerJob, wrapperJob commontypes.Job
+
+	// Job read from JobManager queue looks like a failure of first wrapper
+	managerJob.ID = "TestMemoryInvalidOriginIsDeadLetteredManager"
+	managerJob.Type = commontypes.ArtistInfoRetrieval
+	managerJob.LastOrigin = "first"
+
+	wrapperJob.ID = "TestMemoryInvalidOriginIsDeadLetteredWrapper"
+	wrapperJob.Status = true
+	wrapperJob.Type = commontypes.ArtistInfoRetrieval
+	wrapperJob.LastOrigin = "third"
+
+	testConfig := memoryTestConfig()
+	statusReporter := &status.RecordingReporter{}
+	memory := routeWithMemoryBroker(t, testConfig, statusReporter, &storage.RecordingResultStore{},
+		routing.NewJob(managerJob, nil).WithSource(testConfig.JobManager.Name),
+		routing.NewJob(wrapperJob, nil).WithSource(testConfig.WrapperOutput.Name))
+
+	if len(memory.Messages("second")) != 0 {
+		t.Errorf("Job read from JobManager queue should not be sent to the next wrapper.")
+	}
+	deadLetters := memory.Messages(testConfig.DeadLetter.Queue)
+	if len(deadLetters) != 2 {
+		t.Fatalf("Dead letter queue should have 2 messages, not %d.", len(deadLetters))
+	}
+	if deadLetters[0].Headers[deadletter.ReasonHeader] != string(deadletter.InvalidOrigin) || deadLetters[0].Headers[deadletter.SourceQueueHeader] != testConfig.JobManager.Name {
+		t.Errorf("JobManager job should be dead-lettered as invalid origin, headers were %+v.", deadLetters[0].Headers)
+	}
+	if deadLetters[1].Headers[deadletter.ReasonHeader] != string(deadletter.UnknownWrapper) || deadLetters[1].Headers[deadletter.SourceQueueHeader] != testConfig.WrapperOutput.Name {
+		t.Errorf("Unknown wrapper job should be dead-lettered as unknown wrapper, headers were %+v.", deadLetters[1].Headers)
+	}
+	if reported := statusReporter.Jobs(); len(reported) != 2 || reported[0].Status || reported[1].Status {
+		t.Errorf("Dead-lettered jobs should be reported as failed, reported jobs were %+v.", reported)
+	}
+}
+
+func TestMemoryRefusedDeadLetterIsRejected(t *testing.T) {
+
+	var unroutableJob, newJob commontypes.Job
+
+	unroutableJob.ID = "TestMemoryRefusedDeadLetterIsRejectedUnroutable"
+	unroutableJob.Status = true
+	unroutableJob.Type = commontypes.ArtistInfoRetrieval
+	unroutableJob.LastOrigin = "JobManager"
+	unroutableJob.RequiredOrigin = "third"
+
+	newJob.ID = "TestMemoryRefusedDeadLetterIsRejectedNew"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	testConfig := memoryTestConfig()
+	memory := broker.NewMemory()
+	memory.Refuse(testConfig.DeadLetter.Queue)
+	unroutableDelivery := &AcknowledgerMock{}
+	// routeOn fails the test if RouteJobs returns an error
+	routeOn(t, memory, testConfig, &status.RecordingReporter{}, &storage.RecordingResultStore{}, logging.Discard(), routing.NewPauses(), nil,
+		routing.NewJob(unroutableJob, unroutableDelivery),
+		routing.NewJob(newJob, nil))
+
+	if unroutableDelivery.Rejected != 1 || unroutableDelivery.Requeued != 0 || unroutableDelivery.Acked != 0 {
+		t.Errorf("Job refused by dead letter exchange should be rejected, delivery was %+v.", *unroutableDelivery)
+	}
+	if len(memory.Messages("first")) != 1 {
+		t.Errorf("Jobs received after a refused dead letter should be routed.")
+	}
+}
+
+func TestMemoryDieFromWrapperOutputIsDeadLettered(t *testing.T) {
+
+	var dieJob, newJob commontypes.Job
+
+	// A wrapper can't stop JobRouter
+	dieJob.ID = "TestMemoryDieFromWrapperOutputIsDeadLetteredDie"
+	dieJob.Status = true
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "first"
+	dieJob.RequiredOrigin = "JobRouter"
+
+	newJob.ID = "TestMemoryDieFromWrapperOutputIsDeadLetteredNew"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	testConfig := memoryTestConfig()
+	dieDelivery := &AcknowledgerMock{}
+	memory := routeWithMemoryBroker(t, testConfig, &status.RecordingReporter{}, &storage.RecordingResultStore{},
+		routing.NewJob(dieJob, dieDelivery).WithSource(testConfig.WrapperOutput.Name),
+		routing.NewJob(newJob, nil).WithSource(testConfig.JobManager.Name))
+
+	deadLetters := memory.Messages(testConfig.DeadLetter.Queue)
+	if len(deadLetters) != 1 {
+		t.Fatalf("Dead letter queue should have 1 message, not %d.", len(deadLetters))
+	}
+	if deadLetters[0].Headers[deadletter.ReasonHeader] != string(deadletter.InvalidOrigin) || deadLetters[0].Headers[deadletter.SourceQueueHeader] != testConfig.WrapperOutput.Name {
+		t.Errorf("Die job read from wrapperoutput queue should be dead-lettered as invalid origin, headers were %+v.", deadLetters[0].Headers)
+	}
+	if dieDelivery.Acked != 1 {
+		t.Errorf("Dead-lettered Die job delivery should be acked, delivery was %+v.", *dieDelivery)
+	}
+	if len(memory.Messages("first")) != 1 {
+		t.Errorf("JobRouter should keep routing jobs after a Die job read from wrapperoutput queue.")
+	}
+}
+
+func TestMemoryFinishedJobIsDeadLetteredWhenStatusFails(t *testing.T) {
+
+	var finishedJob commontypes.Job
+
+	finishedJob.ID = "TestMemoryFinishedJobIsDeadLetteredWhenStatusFails"
+	finishedJob.Status = true
+	finishedJob.Finished = true
+	finishedJob.Type = commontypes.ArtistInfoRetrieval
+	finishedJob.LastOrigin = "first"
+
+	testConfig := memoryTestConfig()
+	statusReporter := &status.RecordingReporter{Err: errors.New("Failed to update status.")}
+	resultStore := &storage.RecordingResultStore{}
+	memory := routeWithMemoryBroker(t, testConfig, statusReporter, resultStore, routing.NewJob(finishedJob, nil))
+
+	deadLetters := memory.Messages(testConfig.DeadLetter.Queue)
+	if len(deadLetters) != 1 {
+		t.Fatalf("Dead letter queue should have 1 message, not %d.", len(deadLetters))
+	}
+	if deadLetters[0].Headers[deadletter.ReasonHeader] != string(deadletter.StatusServiceFailure) {
+		t.Errorf("Dead letter reason should be '%s', not '%v'.", deadletter.StatusServiceFailure, deadLetters[0].Headers[deadletter.ReasonHeader])
+	}
+	if deadLetters[0].Headers[deadletter.SourceQueueHeader] != testConfig.WrapperOutput.Name {
+		t.Errorf("Dead letter source queue should be '%s', not '%v'.", testConfig.WrapperOutput.Name, deadLetters[0].Headers[deadletter.SourceQueueHeader])
+	}
+	if len(resultStore.Jobs()) != 0 {
+		t.Errorf("Job should not be stored when status Manager fails.")
+	}
+}
+
+func TestMemoryFinishedJobIsReportedAndStored(t *testing.T) {
+
+	var finishedJob commontypes.Job
+
+	finishedJob.ID = "TestMemoryFinishedJobIsReportedAndStored"
+	finishedJob.Status = true
+	finishedJob.Finished = false
+	finishedJob.Type = commontypes.ArtistInfoRetrieval
+	finishedJob.LastOrigin = "first"
+
+	statusReporter := &status.RecordingReporter{}
+	resultStore := &storage.RecordingResultStore{}
+	routeWithMemoryBroker(t, memoryTestConfig(), statusReporter, resultStore, routing.NewJob(finishedJob, nil))
+
+	reportedJobs := statusReporter.Jobs()
+	if len(reportedJobs) != 1 || reportedJobs[0].ID != finishedJob.ID || !reportedJobs[0].Finished {
+		t.Errorf("Finished job should have been reported to status Manager, reported jobs were %+v.", reportedJobs)
+	}
+	storedJobs := resultStore.Jobs()
+	if len(storedJobs) != 1 || storedJobs[0].ID != finishedJob.ID {
+		t.Errorf("Finished job should have been stored, stored jobs were %+v.", storedJobs)
+	}
+}
+
+func TestMemoryStorageFailureIsDeadLettered(t *testing.T) {
+
+	var finishedJob commontypes.Job
+
+	finishedJob.ID = "TestMemoryStorageFailureIsDeadLettered"
+	finishedJob.Status = true
+	finishedJob.Type = commontypes.ArtistInfoRetrieval
+	finishedJob.LastOrigin = "first"
+
+	testConfig := memoryTestConfig()
+	statusReporter := &status.RecordingReporter{}
+	resultStore := &storage.RecordingResultStore{Err: errors.New("Failed to store job.")}
+	memory := routeWithMemoryBroker(t, testConfig, statusReporter, resultStore, routing.NewJob(finishedJob, nil))
+
+	deadLetters := memory.Messages(testConfig.DeadLetter.Queue)
+	if len(deadLetters) != 1 {
+		t.Fatalf("Dead letter queue should have 1 message, not %d.", len(deadLetters))
+	}
+	if deadLetters[0].Headers[deadletter.ReasonHeader] != string(deadletter.StorageServiceFailure) {
+		t.Errorf("Dead letter reason should be '%s', not '%v'.", deadletter.StorageServiceFailure, deadLetters[0].Headers[deadletter.ReasonHeader])
+	}
+	// Job is reported as finished first and as failed once storage fails
+	reportedJobs := statusReporter.Jobs()
+	if len(reportedJobs) != 2 || reportedJobs[1].Status {
+		t.Errorf("Storage failure should be reported to status Manager, reported jobs were %+v.", reportedJobs)
+	}
+}
+
+func TestMemoryRoutingMetrics(t *testing.T) {
+
+	var failedJob, finishedJob commontypes.Job
+
+	failedJob.ID = "TestMemoryRoutingMetricsFailed"
+	failedJob.Type = commontypes.JobInfoRetrieval
+	failedJob.LastOrigin = "first"
+
+	finishedJob.ID = "TestMemoryRoutingMetricsFinished"
+	finishedJob.Status = true
+	finishedJob.Type = commontypes.JobInfoRetrieval
+	finishedJob.LastOrigin = "second"
+
+	published := testutil.ToFloat64(metrics.JobsPublished.WithLabelValues("second", "jobinforetrieval"))
+	fallbacks := testutil.ToFloat64(metrics.JobFallbacks.WithLabelValues("first", "second", "jobinforetrieval"))
+	succeeded := testutil.ToFloat64(metrics.JobsFinished.WithLabelValues(metrics.Succeeded, "second", "jobinforetrieval"))
+
+	routeWithMemoryBroker(t, memoryTestConfig(), &status.RecordingReporter{}, &storage.RecordingResultStore{}, routing.NewJob(failedJob, &AcknowledgerMock{}), routing.NewJob(finishedJob, &AcknowledgerMock{}))
+
+	if testutil.ToFloat64(metrics.JobsPublished.WithLabelValues("second", "jobinforetrieval")) != published+1 {
+		t.Errorf("Job sent to second wrapper should be counted as published.")
+	}
+	if testutil.ToFloat64(metrics.JobFallbacks.WithLabelValues("first", "second", "jobinforetrieval")) != fallbacks+1 {
+		t.Errorf("Job failed by first wrapper should be counted as a fallback to second one.")
+	}
+	if testutil.ToFloat64(metrics.JobsFinished.WithLabelValues(metrics.Succeeded, "second", "jobinforetrieval")) != succeeded+1 {
+		t.Errorf("Finished job should be counted as succeeded by the wrapper that processed it.")
+	}
+}
+
+func TestMemoryRoutingDecisionsAreLogged(t *testing.T) {
+
+	var newJob, failedJob commontypes.Job
+
+	newJob.ID = "TestMemoryRoutingDecisionsAreLoggedNew"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	failedJob.ID = "TestMemoryRoutingDecisionsAreLoggedFailed"
+	failedJob.Type = commontypes.ArtistInfoRetrieval
+	failedJob.LastOrigin = "second"
+	failedJob.Error = "Not found."
+
+	logger, hook := logrustest.NewNullLogger()
+	routeWith(t, memoryTestConfig(), &status.RecordingReporter{}, &storage.RecordingResultStore{}, logger, routing.NewPauses(), nil, routing.NewJob(newJob, nil), routing.NewJob(failedJob, nil))
+
+	entries := hook.AllEntries()
+	if len(entries) != 3 {
+		t.Fatalf("Each routing decision should be logged, %d entries were logged.", len(entries))
+	}
+	published := entries[0].Data
+	if published["job_id"] != newJob.ID || published["job_type"] != "artistinforetrieval" || published["last_origin"] != "JobManager" || published["outcome"] != logging.Published || published["queue"] != "first" || published["decision"] != firstWrapper {
+		t.Errorf("New job entry should describe it has been sent to first wrapper, entry was %+v.", published)
+	}
+	failed := entries[1]
+	if failed.Level != logrus.WarnLevel || failed.Data["job_id"] != failedJob.ID || failed.Data["outcome"] != logging.Failed || failed.Data["error"] != "Not found." {
+		t.Errorf("Failed job entry should describe it has failed, entry was %+v.", failed.Data)
+	}
+	if entries[2].Data["job_type"] != "die" {
+		t.Errorf("Die job should be logged, entry was %+v.", entries[2].Data)
+	}
+}
+
+func TestMemoryRoutingDecisionsAreRecorded(t *testing.T) {
+
+	var newJob, unknownJob commontypes.Job
+
+	newJob.ID = "TestMemoryRoutingDecisionsAreRecordedNew"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	unknownJob.ID = "TestMemoryRoutingDecisionsAreRecordedUnknown"
+	unknownJob.Status = true
+	unknownJob.Type = commontypes.ArtistInfoRetrieval
+	unknownJob.LastOrigin = "JobManager"
+	unknownJob.RequiredOrigin = "third"
+
+	// Decisions are recorded whatever log level is
+	logger := logging.Discard()
+	logger.SetLevel(logrus.ErrorLevel)
+	decisions := routing.NewDecisions(0)
+	routeWith(t, memoryTestConfig(), &status.RecordingReporter{}, &storage.RecordingResultStore{}, logger, routing.NewPauses(), decisions, routing.NewJob(newJob, nil), routing.NewJob(unknownJob, nil))
+
+	recent := decisions.Recent()
+	if len(recent) != 2 {
+		t.Fatalf("Each routing decision should be recorded, %d decisions were recorded.", len(recent))
+	}
+	published := recent[0]
+	if published.JobID != newJob.ID || published.JobType != "artistinforetrieval" || published.Outcome != logging.Published || published.Queue != "first" || published.Decision != firstWrapper {
+		t.Errorf("New job decision should describe it has been sent to first wrapper, decision was %+v.", published)
+	}
+	deadLettered := recent[1]
+	if deadLettered.JobID != unknownJob.ID || deadLettered.Outcome != logging.DeadLettered || deadLettered.Reason != string(deadletter.UnknownWrapper) || deadLettered.Queue != "DeadLetter" {
+		t.Errorf("Unknown wrapper decision should describe it has been dead-lettered, decision was %+v.", deadLettered)
+	}
+}
+
+func TestMemoryTraceContextIsSentToWrapper(t *testing.T) {
+
+	var newJob commontypes.Job
+
+	newJob.ID = "TestMemoryTraceContextIsSentToWrapper"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	jobCtx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, Remote: true}))
+
+	memory := routeWithMemoryBroker(t, memoryTestConfig(), &status.RecordingReporter{}, &storage.RecordingResultStore{}, routing.NewJob(newJob, nil).WithContext(jobCtx))
+
+	messages := memory.Messages("first")
+	if len(messages) != 1 {
+		t.Fatalf("New job should have been sent to first wrapper, first wrapper queue has %d jobs.", len(messages))
+	}
+	traceparent, _ := messages[0].Headers["traceparent"].(string)
+	if !strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Errorf("Job should be sent along with the trace context it was received with, traceparent was '%s'.", traceparent)
+	}
+}
+
+func TestMemoryPausedWrapperIsSkipped(t *testing.T) {
+
+	var newJob, failedJob commontypes.Job
+
+	newJob.ID = "TestMemoryPausedWrapperIsSkippedNew"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	failedJob.ID = "TestMemoryPausedWrapperIsSkippedFailed"
+	failedJob.Type = commontypes.ArtistInfoRetrieval
+	failedJob.LastOrigin = "first"
+
+	testConfig := memoryTestConfig()
+	testConfig.Wrappers = append(testConfig.Wrappers, config.Queue{Name: "third"})
+	pauses := routing.NewPauses()
+	pauses.Pause("first")
+	pauses.Pause("second")
+
+	memory := routeWith(t, testConfig, &status.RecordingReporter{}, &storage.RecordingResultStore{}, logging.Discard(), pauses, nil, routing.NewJob(newJob, nil), routing.NewJob(failedJob, nil))
+
+	thirdWrapperJobs := decodeQueueJobs(t, memory, "third")
+	if len(thirdWrapperJobs) != 2 || thirdWrapperJobs[0].ID != newJob.ID || thirdWrapperJobs[1].ID != failedJob.ID {
+		t.Fatalf("Jobs should have skipped paused wrappers, third wrapper queue has %d jobs.", len(thirdWrapperJobs))
+	}
+	if len(memory.Messages("first")) != 0 || len(memory.Messages("second")) != 0 {
+		t.Errorf("No jobs should have been sent to paused wrappers.")
+	}
+}
+
+func TestMemoryJobIsHeldForPausedWrapper(t *testing.T) {
+
+	var requiredJob, newJob commontypes.Job
+
+	requiredJob.ID = "TestMemoryJobIsHeldForPausedWrapperRequired"
+	requiredJob.Status = true
+	requiredJob.Type = commontypes.ArtistInfoRetrieval
+	requiredJob.LastOrigin = "JobManager"
+	requiredJob.RequiredOrigin = "first"
+
+	newJob.ID = "TestMemoryJobIsHeldForPausedWrapperNew"
+	newJob.Status = true
+	newJob.Type = commontypes.ArtistInfoRetrieval
+	newJob.LastOrigin = "JobManager"
+
+	pauses := routing.NewPauses()
+	pauses.Pause("first")
+	memory := broker.NewMemory()
+	defer memory.Close()
+	wrapperChannel := make(chan routing.Job)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	routeJobsDone := make(chan error)
+
+	go func() {
+		routeJobsDone <- RouteJobs(ctx, memoryTestConfig(), memory, wrapperChannel, &status.RecordingReporter{}, &storage.RecordingResultStore{}, logging.Discard(), pauses, nil)
+	}()
+
+	heldDelivery := &AcknowledgerMock{}
+	wrapperChannel <- routing.NewJob(requiredJob, heldDelivery)
+	// Held job does not stop other jobs from being routed
+	wrapperChannel <- routing.NewJob(newJob, nil)
+	for deadline := time.Now().Add(time.Second); len(memory.Messages("second")) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(memory.Messages("second")) != 1 {
+		t.Fatalf("Jobs for wrappers that are not paused should be routed while another job is held.")
+	}
+	if len(memory.Messages("first")) != 0 || *heldDelivery != (AcknowledgerMock{}) {
+		t.Fatalf("Held job should not be sent nor acknowledged while its wrapper is paused, delivery was %+v.", *heldDelivery)
+	}
+
+	pauses.Resume("first")
+	for deadline := time.Now().Add(time.Second); len(memory.Messages("first")) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(memory.Messages("first")) != 1 {
+		t.Errorf("Held job should be sent once its wrapper is resumed.")
+	}
+
+	// A job held when router is stopped is requeued
+	pauses.Pause("first")
+	stoppedDelivery := &AcknowledgerMock{}
+	wrapperChannel <- routing.NewJob(requiredJob, stoppedDelivery)
+	cancel()
+	if err := <-routeJobsDone; err != nil {
+		t.Errorf("RouteJobs should return no errors when it is stopped, error was '%s'.", err.Error())
+	}
+	if heldDelivery.Acked != 1 || stoppedDelivery.Requeued != 1 {
+		t.Errorf("Routed job should be acked and held job requeued, deliveries were %+v and %+v.", *heldDelivery, *stoppedDelivery)
+	}
+}
+
+func TestMemoryLostHeldJobIsDropped(t *testing.T) {
+
+	var requiredJob commontypes.Job
+
+	requiredJob.ID = "TestMemoryLostHeldJobIsDropped"
+	requiredJob.Status = true
+	requiredJob.Type = commontypes.ArtistInfoRetrieval
+	requiredJob.LastOrigin = "JobManager"
+	requiredJob.RequiredOrigin = "first"
+	encodedJob, _ := commontypes.EncodeJob(requiredJob)
+
+	testConfig := memoryTestConfig()
+	pauses := routing.NewPauses()
+	pauses.Pause("first")
+	memory := broker.NewMemory()
+	defer memory.Close()
+	memory.DeclareQueue(testConfig.JobManager.Name)
+	memory.Publish(context.Background(), testConfig.JobManager.Name, broker.Message{Body: encodedJob})
+
+	wrapperChannel := make(chan routing.Job)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	routeJobsDone := make(chan error)
+	go func() {
+		routeJobsDone <- RouteJobs(ctx, testConfig, memory.Connection(), wrapperChannel, &status.RecordingReporter{}, &storage.RecordingResultStore{}, logging.Discard(), pauses, nil)
+	}()
+
+	// Job is held, then reader connection is lost and the same job is delivered and held again
+	deliveries, _ := memory.Consume(ctx, testConfig.JobManager.Name)
+	wrapperChannel <- routing.NewJob(requiredJob, <-deliveries).WithSource(testConfig.JobManager.Name)
+	memory.Disconnect()
+	deliveries, _ = memory.Consume(ctx, testConfig.JobManager.Name)
+	wrapperChannel <- routing.NewJob(requiredJob, <-deliveries).WithSource(testConfig.JobManager.Name)
+
+	pauses.Resume("first")
+	for deadline := time.Now().Add(time.Second); len(memory.Messages("first")) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Give router the chance to send a duplicate
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-routeJobsDone; err != nil {
+		t.Errorf("RouteJobs should return no errors when it is stopped, error was '%s'.", err.Error())
+	}
+
+	if len(memory.Messages("first")) != 1 {
+		t.Errorf("Held job should be sent once after its delivery has been lost, first wrapper queue has %d jobs.", len(memory.Messages("first")))
+	}
+	if len(memory.Messages(testConfig.JobManager.Name)) != 0 {
+		t.Errorf("Job delivered again should be acknowledged once it has been routed.")
+	}
+}
@@ -0,0 +1,52 @@
+// +build integration_tests unit_tests
+
+package wrappers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+)
+
+type RoundTripperMock struct {
+	Response *http.Response
+	RespErr  error
+}
+
+func (rtm *RoundTripperMock) RoundTrip(*http.Request) (*http.Response, error) {
+	return rtm.Response, rtm.RespErr
+}
+
+// HostRoundTripperMock returns a different status code for each host
+type HostRoundTripperMock struct {
+	StatusCodes map[string]int
+}
+
+func (hrtm *HostRoundTripperMock) RoundTrip(request *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: hrtm.StatusCodes[request.URL.Host], Body: ioutil.NopCloser(bytes.NewBufferString(`
+	not html code
+		`))}, nil
+}
+
+type AcknowledgerMock struct {
+	Acked    int
+	Requeued int
+	Rejected int
+}
+
+func (am *AcknowledgerMock) Ack(multiple bool) error {
+	am.Acked++
+	return nil
+}
+
+func (am *AcknowledgerMock) Nack(multiple, requeue bool) error {
+	if requeue {
+		am.Requeued++
+	}
+	return nil
+}
+
+func (am *AcknowledgerMock) Reject(requeue bool) error {
+	am.Rejected++
+	return nil
+}
@@ -1,149 +1,475 @@
 package wrappers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"strconv"
 
 	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
 	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/deadletter"
+	"github.com/a-castellano/music-manager-job-router/health"
+	"github.com/a-castellano/music-manager-job-router/logging"
+	"github.com/a-castellano/music-manager-job-router/metrics"
+	"github.com/a-castellano/music-manager-job-router/routing"
 	"github.com/a-castellano/music-manager-job-router/status"
 	"github.com/a-castellano/music-manager-job-router/storage"
-	"github.com/streadway/amqp"
+	"github.com/a-castellano/music-manager-job-router/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func RouteJobs(config config.Config, wrapperChannel chan commontypes.Job, client http.Client) error {
+// Routing decisions, they are logged as decision field along with published jobs
+const (
+	firstWrapper   = "first_wrapper"
+	requiredOrigin = "required_origin"
+	nextWrapperOf  = "next_wrapper"
+)
+
+// Span attributes describing routed jobs and routing decisions
+const (
+	jobIDKey          = attribute.Key("job.id")
+	jobTypeKey        = attribute.Key("job.type")
+	lastOriginKey     = attribute.Key("job.last_origin")
+	requiredOriginKey = attribute.Key("job.required_origin")
+	outcomeKey        = attribute.Key("job.outcome")
+	decisionKey       = attribute.Key("job.decision")
+)
+
+var (
+	// errDie is returned by route when a Die job addressed to JobRouter is received
+	errDie = errors.New("Die job received.")
+	// errPaused is returned by route when every wrapper job can be sent to is paused
+	errPaused = errors.New("Every wrapper job can be sent to is paused.")
+)
+
+// jobError is a problem that only affects one job, that job is dead-lettered and RouteJobs keeps running
+type jobError struct {
+	reason deadletter.Reason
+	err    error
+}
+
+func (e *jobError) Error() string {
+	return e.err.Error()
+}
 
-	wrapperQueues := make(map[string]amqp.Queue)
-	wrapperQueuesPosition := make(map[string]int)
-	var wrapperOrder []string
-	var wrapperCounter int = 0
+func (e *jobError) Unwrap() error {
+	return e.err
+}
 
-	connection_string := "amqp://" + config.Server.User + ":" + config.Server.Password + "@" + config.Server.Host + ":" + strconv.Itoa(config.Server.Port) + "/"
-	conn, err := amqp.Dial(connection_string)
+type router struct {
+	config        config.Config
+	broker        broker.Broker
+	status        status.Reporter
+	results       storage.ResultStore
+	deadLetter    *deadletter.DeadLetter
+	wrapperQueues map[string]bool
+	wrapperOrder  []string
+	logger        logrus.FieldLogger
+	pauses        *routing.Pauses
+	decisions     *routing.Decisions
+	// held keeps jobs whose wrappers are paused, their deliveries stay unacked until one of them is resumed
+	held []routing.Job
+}
 
+// sendJob publishes encodedJob to queueName along with trace context of ctx
+func sendJob(ctx context.Context, jobBroker broker.Broker, queueName string, encodedJob []byte) error {
+	headers := make(map[string]interface{})
+	tracing.Propagator.Inject(ctx, tracing.HeadersCarrier(headers))
+	err := jobBroker.Publish(ctx, queueName, broker.Message{Body: encodedJob, Headers: headers})
 	if err != nil {
-		return fmt.Errorf("Failed to stablish connection with RabbitMQ: %w", err)
+		return fmt.Errorf("Failed to send job to qeue %s in RouteJobs: %w", queueName, err)
 	}
-	defer conn.Close()
+	return nil
+}
 
-	ch, err := conn.Channel()
-	if err != nil {
-		return fmt.Errorf("Failed to open a channel in RouteJobs: %w", err)
+// refused reports whether broker has refused a publishing, it only affects that publishing
+func refused(err error) bool {
+	return errors.Is(err, broker.ErrNacked) || errors.Is(err, broker.ErrConfirmTimeout)
+}
+
+func noRouteError(jobType commontypes.JobType) string {
+	return "There is no route defined for job type " + config.JobTypeName(jobType) + "."
+}
+
+// remainingWrappers returns the wrappers placed after lastOrigin in route
+func remainingWrappers(route []string, lastOrigin string) []string {
+	for position, wrapperName := range route {
+		if wrapperName == lastOrigin {
+			return route[position+1:]
+		}
 	}
-	defer ch.Close()
+	return nil
+}
 
-	for _, wrapper := range config.Wrappers {
-		wrapperQueue, err := ch.QueueDeclare(
-			wrapper.Name, // name
-			true,         // durable
-			false,        // delete when unused
-			false,        // exclusive
-			false,        // no-wait
-			nil,          // arguments
-		)
-		if err != nil {
-			return fmt.Errorf("Failed to declare queue %s in RouteJobs: %w", wrapper.Name, err)
+// target returns the first wrapper of candidates that routing has not been paused to, errPaused is returned when all of them are paused
+func (r *router) target(candidates []string) (string, error) {
+	for _, wrapperName := range candidates {
+		if !r.pauses.Paused(wrapperName) {
+			return wrapperName, nil
 		}
-		wrapperQueues[wrapper.Name] = wrapperQueue
-		wrapperQueuesPosition[wrapper.Name] = wrapperCounter
-		wrapperOrder = append(wrapperOrder, wrapper.Name)
-		wrapperCounter++
 	}
-	for {
-		jobToRoute := <-wrapperChannel
-		encodedJob, _ := commontypes.EncodeJob(jobToRoute)
-		if jobToRoute.LastOrigin == "JobManager" {
-			if jobToRoute.RequiredOrigin == "" {
-				// Send to first wrapper
-				err = ch.Publish(
-					"",              // exchange
-					wrapperOrder[0], // routing key
-					false,           // mandatory
-					false,
-					amqp.Publishing{
-						DeliveryMode: amqp.Persistent,
-						ContentType:  "text/plain",
-						Body:         encodedJob,
-					})
-				if err != nil {
-					return fmt.Errorf("Failed to send job to qeue %s in RouteJobs: %w", wrapperOrder[0], err)
-				}
-			} else {
-				// check if required origin exists
-				if _, ok := wrapperQueues[jobToRoute.RequiredOrigin]; ok {
-					err = ch.Publish(
-						"",                        // exchange
-						jobToRoute.RequiredOrigin, // routing key
-						false,                     // mandatory
-						false,
-						amqp.Publishing{
-							DeliveryMode: amqp.Persistent,
-							ContentType:  "text/plain",
-							Body:         encodedJob,
-						})
-					if err != nil {
-						return fmt.Errorf("Failed to send job to qeue %s in RouteJobs: %w", jobToRoute.RequiredOrigin, err)
-					}
-
-				} else {
-					return fmt.Errorf("Wrapper '%s' does not exist.", jobToRoute.RequiredOrigin)
-				}
+	return "", errPaused
+}
+
+// jobRoute returns the ordered wrapper list that processes jobType, wrappers order is used when no routes are configured
+func (r *router) jobRoute(jobType commontypes.JobType) ([]string, bool) {
+	if r.config.Routes == nil {
+		return r.wrapperOrder, true
+	}
+	route, ok := r.config.Routes[jobType]
+	return route, ok
+}
+
+// checkSource returns a jobError when routedJob origin is not allowed in the queue it was read from.
+// JobManager queue only receives new jobs and wrapperoutput queue only receives jobs from configured wrappers.
+// Die jobs addressed to JobRouter are only accepted from JobManager, jobs created by JobRouter come from its Die jobs.
+func (r *router) checkSource(routedJob routing.Job) error {
+	job := routedJob.Job
+	if job.Type == commontypes.Die && job.RequiredOrigin == "JobRouter" && routedJob.Source() != "" && routedJob.Source() != r.config.JobManager.Name {
+		return &jobError{reason: deadletter.InvalidOrigin, err: errors.New("Die jobs addressed to JobRouter can only be read from JobManager queue")}
+	}
+	switch routedJob.Source() {
+	case r.config.JobManager.Name:
+		if job.LastOrigin != "JobManager" {
+			return &jobError{reason: deadletter.InvalidOrigin, err: errors.New("LastOrigin can only be 'JobManager'")}
+		}
+	case r.config.WrapperOutput.Name:
+		if !r.wrapperQueues[job.LastOrigin] {
+			return &jobError{reason: deadletter.UnknownWrapper, err: fmt.Errorf("LastOrigin '%s' is not a configured wrapper", job.LastOrigin)}
+		}
+	}
+	return nil
+}
+
+// sourceQueue returns the queue routedJob was read from, it is guessed from job origin for jobs created by JobRouter
+func (r *router) sourceQueue(routedJob routing.Job) string {
+	if routedJob.Source() != "" {
+		return routedJob.Source()
+	}
+	if routedJob.Job.LastOrigin == "JobManager" {
+		return r.config.JobManager.Name
+	}
+	return r.config.WrapperOutput.Name
+}
+
+// jobLogger returns a logger that adds job fields to every entry
+func (r *router) jobLogger(job commontypes.Job) logrus.FieldLogger {
+	return r.logger.WithFields(logging.JobFields(job))
+}
+
+// record keeps decision taken for job so it can be listed through admin API
+func (r *router) record(job commontypes.Job, decision routing.Decision) {
+	decision.JobID = job.ID
+	decision.JobType = metrics.JobType(job.Type)
+	decision.LastOrigin = job.LastOrigin
+	decision.RequiredOrigin = job.RequiredOrigin
+	r.decisions.Record(decision)
+}
+
+// wrapperLabel returns the wrapper metrics label of job, it is the last wrapper that processed job.
+// It is empty for jobs no wrapper has processed and unknown for jobs coming from wrappers that are not configured.
+func (r *router) wrapperLabel(job commontypes.Job) string {
+	if r.wrapperQueues[job.LastOrigin] {
+		return job.LastOrigin
+	}
+	if job.LastOrigin == "JobManager" || job.LastOrigin == "JobRouter" {
+		return ""
+	}
+	return metrics.Unknown
+}
+
+// jobAttributes returns the span attributes that identify job
+func jobAttributes(job commontypes.Job) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("rabbitmq"),
+		jobIDKey.String(job.ID),
+		jobTypeKey.String(metrics.JobType(job.Type)),
+		lastOriginKey.String(job.LastOrigin),
+		requiredOriginKey.String(job.RequiredOrigin),
+	}
+}
+
+// updateStatus sends job to status Manager, failures only affect this job
+func (r *router) updateStatus(ctx context.Context, job commontypes.Job) error {
+	err := r.status.UpdateJobStatus(ctx, job)
+	if err != nil {
+		return &jobError{reason: deadletter.StatusServiceFailure, err: fmt.Errorf("Failed to send job to status Manager in RouteJobs: %w", err)}
+	}
+	return nil
+}
+
+// fail marks job as finished and failed and sends it to status Manager
+func (r *router) fail(ctx context.Context, job commontypes.Job) error {
+	job.Status = false
+	job.Finished = true
+	err := r.updateStatus(ctx, job)
+	if err == nil {
+		trace.SpanFromContext(ctx).SetAttributes(outcomeKey.String(logging.Failed))
+		metrics.JobsFinished.WithLabelValues(metrics.Failed, r.wrapperLabel(job), metrics.JobType(job.Type)).Inc()
+		r.jobLogger(job).WithFields(logrus.Fields{"outcome": logging.Failed, "error": job.Error}).Warn("Job has failed.")
+		r.record(job, routing.Decision{Outcome: logging.Failed, Error: job.Error})
+	}
+	return err
+}
+
+// publish sends job to queueName, decision tells why that wrapper has been chosen.
+// When broker refuses job it is marked as failed and sent to status Manager.
+func (r *router) publish(ctx context.Context, queueName string, job commontypes.Job, decision string) error {
+	encodedJob, _ := commontypes.EncodeJob(job)
+	err := sendJob(ctx, r.broker, queueName, encodedJob)
+	if err == nil {
+		trace.SpanFromContext(ctx).SetAttributes(outcomeKey.String(logging.Published), semconv.MessagingDestinationKey.String(queueName), decisionKey.String(decision))
+		metrics.JobsPublished.WithLabelValues(queueName, metrics.JobType(job.Type)).Inc()
+		r.jobLogger(job).WithFields(logrus.Fields{"outcome": logging.Published, "queue": queueName, "decision": decision}).Info("Job has been sent to wrapper.")
+		r.record(job, routing.Decision{Outcome: logging.Published, Queue: queueName, Decision: decision})
+		return nil
+	}
+	if !refused(err) {
+		return err
+	}
+	job.Error = err.Error()
+	return r.fail(ctx, job)
+}
+
+// route decides where jobToRoute goes, errors that are not jobError are fatal.
+// ctx holds the span of this routing decision.
+func (r *router) route(ctx context.Context, jobToRoute commontypes.Job) error {
+	if jobToRoute.LastOrigin == "JobManager" {
+		if jobToRoute.RequiredOrigin == "" {
+			// Send to first wrapper of job type route
+			route, ok := r.jobRoute(jobToRoute.Type)
+			if !ok {
+				// There is no wrapper able to process this job, job is marked as failed
+				jobToRoute.Error = noRouteError(jobToRoute.Type)
+				return r.fail(ctx, jobToRoute)
+			}
+			wrapperName, err := r.target(route)
+			if err != nil {
+				return err
+			}
+			return r.publish(ctx, wrapperName, jobToRoute, firstWrapper)
+		}
+		// check if required origin exists
+		if !r.wrapperQueues[jobToRoute.RequiredOrigin] {
+			return &jobError{reason: deadletter.UnknownWrapper, err: fmt.Errorf("Wrapper '%s' does not exist.", jobToRoute.RequiredOrigin)}
+		}
+		// Die jobs stop wrappers even if routing to them has been paused
+		if jobToRoute.Type != commontypes.Die {
+			if _, err := r.target([]string{jobToRoute.RequiredOrigin}); err != nil {
+				return err
 			}
-		} else {
-			// Job has already been proccesed by another of Die signal has been sent
-			if jobToRoute.Status == false {
-
-				//Job failed - check if there are wrappers left to process this job
-				nextPosition := wrapperQueuesPosition[jobToRoute.LastOrigin] + 1
-				if jobToRoute.RequiredOrigin == "" && nextPosition < len(wrapperOrder) {
-					// Send job to next wrapper
-					nextWrapper := wrapperOrder[nextPosition]
-					err = ch.Publish(
-						"",          // exchange
-						nextWrapper, // routing key
-						false,       // mandatory
-						false,
-						amqp.Publishing{
-							DeliveryMode: amqp.Persistent,
-							ContentType:  "text/plain",
-							Body:         encodedJob,
-						})
-					if err != nil {
-						return fmt.Errorf("Failed to send job to qeue %s in RouteJobs: %w", nextWrapper, err)
-					}
-
-				} else {
-					// No more wrappers left, job is marked as failed
-					jobToRoute.Finished = true
-					err = status.UpdateJobStatus(client, config.Status, jobToRoute)
-					if err != nil {
-						return fmt.Errorf("Failed to send job to status Manager in RouteJobs: %w", err)
-					}
-				}
-			} else {
-				// jobFinished or is a Die function
-				if jobToRoute.RequiredOrigin == "JobRouter" {
-
-					if jobToRoute.Type == commontypes.Die {
-						break
-					} else {
-						return fmt.Errorf("Only JobType allowed when RequiredOrigin is JobRouter is Die.")
-					}
-				}
-				jobToRoute.Finished = true
-				err = status.UpdateJobStatus(client, config.Status, jobToRoute)
-				if err != nil {
-					return fmt.Errorf("Failed to send job to status Manager in RouteJobs: %w", err)
-				}
-				err = storage.SendInfoToStorageManager(client, config.Storage, jobToRoute)
-				if err != nil {
-					return fmt.Errorf("Failed to send job to status Manager in RouteJobs: %w", err)
-				}
+		}
+		return r.publish(ctx, jobToRoute.RequiredOrigin, jobToRoute, requiredOrigin)
+	}
 
+	// Job has already been proccesed by another of Die signal has been sent
+	if jobToRoute.Status == false {
+		//Job failed - check if there are wrappers left to process this job
+		route, _ := r.jobRoute(jobToRoute.Type)
+		remaining := remainingWrappers(route, jobToRoute.LastOrigin)
+		if jobToRoute.RequiredOrigin == "" && len(remaining) > 0 {
+			// Send job to next wrapper, paused ones are skipped
+			next, err := r.target(remaining)
+			if err != nil {
+				return err
 			}
+			metrics.JobFallbacks.WithLabelValues(jobToRoute.LastOrigin, next, metrics.JobType(jobToRoute.Type)).Inc()
+			return r.publish(ctx, next, jobToRoute, nextWrapperOf)
 		}
+		// No more wrappers left, job is marked as failed
+		return r.fail(ctx, jobToRoute)
+	}
+
+	// jobFinished or is a Die function
+	if jobToRoute.RequiredOrigin == "JobRouter" {
+		if jobToRoute.Type == commontypes.Die {
+			r.jobLogger(jobToRoute).Info("Die job received, JobRouter stops routing jobs.")
+			return errDie
+		}
+		return &jobError{reason: deadletter.InvalidOrigin, err: errors.New("Only JobType allowed when RequiredOrigin is JobRouter is Die.")}
+	}
+	jobToRoute.Finished = true
+	err := r.updateStatus(ctx, jobToRoute)
+	if err != nil {
+		return err
+	}
+	err = r.results.StoreJobResult(ctx, jobToRoute)
+	if err != nil {
+		return &jobError{reason: deadletter.StorageServiceFailure, err: fmt.Errorf("Failed to send job to storage Manager in RouteJobs: %w", err)}
+	}
+	metrics.JobsFinished.WithLabelValues(metrics.Succeeded, r.wrapperLabel(jobToRoute), metrics.JobType(jobToRoute.Type)).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(outcomeKey.String(logging.Succeeded))
+	r.jobLogger(jobToRoute).WithField("outcome", logging.Succeeded).Info("Job has finished.")
+	r.record(jobToRoute, routing.Decision{Outcome: logging.Succeeded})
+	return nil
+}
+
+// handleJobError records routeErr on job, reports it to status Manager when that is not what failed and dead-letters the job
+func (r *router) handleJobError(ctx context.Context, routedJob routing.Job, routeErr *jobError) error {
+	job := routedJob.Job
+	job.Status = false
+	job.Finished = true
+	job.Error = routeErr.Error()
+	metrics.JobsFinished.WithLabelValues(metrics.Failed, r.wrapperLabel(job), metrics.JobType(job.Type)).Inc()
+	if routeErr.reason != deadletter.StatusServiceFailure {
+		// Job is dead-lettered anyway, status Manager failures are only logged
+		if err := r.status.UpdateJobStatus(ctx, job); err != nil {
+			r.jobLogger(job).WithError(err).Warn("Failed to report job as failed to status Manager.")
+		}
+	}
+	encodedJob, _ := commontypes.EncodeJob(job)
+	trace.SpanFromContext(ctx).SetAttributes(outcomeKey.String(logging.DeadLettered), semconv.MessagingDestinationKey.String(r.config.DeadLetter.Queue))
+	return r.deadLetter.Send(ctx, encodedJob, routeErr.reason, r.sourceQueue(routedJob), job.ID, routeErr.Error())
+}
+
+// routeJob routes routedJob and reports its outcome to its delivery, jobs waiting for a paused wrapper are held.
+// Only errDie and broker connection failures are returned.
+func (r *router) routeJob(routedJob routing.Job) error {
+	// Each routing decision is a span of the trace job was received with
+	jobCtx, span := tracing.Tracer().Start(routedJob.Context(), "route job", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(jobAttributes(routedJob.Job)...))
+	err := r.checkSource(routedJob)
+	if err == nil {
+		err = r.route(jobCtx, routedJob.Job)
+	}
+
+	if err == errDie {
+		tracing.End(span, nil)
+		routedJob.Done(routing.Routed)
+		return err
+	}
+	if err == errPaused {
+		// Job is routed again once one of its wrappers is resumed
+		span.SetAttributes(outcomeKey.String(logging.Held))
+		tracing.End(span, nil)
+		r.jobLogger(routedJob.Job).WithField("outcome", logging.Held).Info("Job is held until a paused wrapper is resumed.")
+		r.record(routedJob.Job, routing.Decision{Outcome: logging.Held})
+		r.held = append(r.held, routedJob)
+		return nil
+	}
+
+	// Span of a dead-lettered job shows why it can't be routed
+	spanErr := err
+	var routeErr *jobError
+	if errors.As(err, &routeErr) {
+		// Job can't be routed, it is recorded as failed and the router goes on
+		r.jobLogger(routedJob.Job).WithFields(logrus.Fields{"outcome": logging.DeadLettered, "queue": r.config.DeadLetter.Queue, "reason": routeErr.reason, "error": routeErr.Error()}).Error("Job can't be routed, it is sent to dead letter queue.")
+		r.record(routedJob.Job, routing.Decision{Outcome: logging.DeadLettered, Queue: r.config.DeadLetter.Queue, Reason: string(routeErr.reason), Error: routeErr.Error()})
+		err = r.handleJobError(jobCtx, routedJob, routeErr)
+		if err != nil {
+			spanErr = err
+		}
+	}
+	tracing.End(span, spanErr)
+
+	if refused(err) {
+		// Dead letter exchange refuses job too, it is rejected so a single job does not stop routing
+		r.jobLogger(routedJob.Job).WithError(err).Error("Dead letter exchange refused job, it is rejected.")
+		routedJob.Done(routing.Rejected)
+		return nil
+	}
+	if err != nil {
+		routedJob.Done(routing.Requeued)
+		return err
 	}
+	// Job has been routed, its delivery can be acknowledged
+	routedJob.Done(routing.Routed)
+	return nil
+}
 
+// routeHeld routes held jobs again, the ones whose wrappers are still paused are held again.
+// Jobs whose delivery channel has been closed are dropped, broker delivers them again and readers send that copy.
+func (r *router) routeHeld() error {
+	held := r.held
+	r.held = nil
+	for position, heldJob := range held {
+		if heldJob.Lost() {
+			// Delivery can't be acknowledged, Done only lets its reader know job is not in flight anymore
+			heldJob.Done(routing.Requeued)
+			r.jobLogger(heldJob.Job).Debug("Held job is dropped, its delivery channel has been closed.")
+			continue
+		}
+		if err := r.routeJob(heldJob); err != nil {
+			r.held = append(r.held, held[position+1:]...)
+			return err
+		}
+	}
 	return nil
 }
+
+// requeueHeld returns held jobs to the queues they were read from
+func (r *router) requeueHeld() {
+	for _, heldJob := range r.held {
+		heldJob.Done(routing.Requeued)
+	}
+	r.held = nil
+}
+
+// RouteJobs routes jobs received from wrapperChannel until ctx is cancelled or a Die job addressed to JobRouter arrives.
+// Jobs that can't be routed are reported as failed and dead-lettered, they are rejected when dead letter exchange refuses them.
+// Only broker connection failures make RouteJobs return an error.
+// A job that has already been received is routed even if ctx is cancelled meanwhile.
+// Jobs whose wrappers are paused in pauses are held without blocking other jobs, they are routed once one of those wrappers is resumed
+// and requeued if RouteJobs returns before that. Every routing decision is logged to logger and kept in decisions, it can be nil.
+func RouteJobs(ctx context.Context, config config.Config, jobBroker broker.Broker, wrapperChannel chan routing.Job, statusReporter status.Reporter, resultStore storage.ResultStore, logger logrus.FieldLogger, pauses *routing.Pauses, decisions *routing.Decisions) error {
+
+	r := &router{
+		config:        config,
+		broker:        jobBroker,
+		status:        statusReporter,
+		results:       resultStore,
+		wrapperQueues: make(map[string]bool),
+		logger:        logger,
+		pauses:        pauses,
+		decisions:     decisions,
+	}
+
+	for _, wrapper := range config.Wrappers {
+		r.wrapperQueues[wrapper.Name] = true
+		r.wrapperOrder = append(r.wrapperOrder, wrapper.Name)
+		jobBroker.DeclareQueue(wrapper.Name)
+	}
+	r.deadLetter = deadletter.New(jobBroker, config.DeadLetter)
+
+	// Connect before routing any job so connection problems are reported right away
+	err := jobBroker.Connect(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to open a channel in RouteJobs: %w", err)
+	}
+
+	defer health.Idle("router")
+	// Held jobs can't be acknowledged once RouteJobs has returned
+	defer r.requeueHeld()
+	// resumed is taken before any job is held so no resume is missed
+	resumed := pauses.Resumed()
+	for {
+		health.Idle("router")
+		var routedJob routing.Job
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-resumed:
+			resumed = pauses.Resumed()
+			health.Busy("router")
+			if err := r.routeHeld(); err != nil {
+				return err
+			}
+			continue
+		case routedJob = <-wrapperChannel:
+		}
+		health.Busy("router")
+		err := r.routeJob(routedJob)
+		if err == errDie {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -4,6 +4,7 @@ package wrappers
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -11,7 +12,13 @@ import (
 	"testing"
 
 	commontypes "github.com/a-castellano/music-manager-common-types/types"
+	"github.com/a-castellano/music-manager-job-router/broker"
 	"github.com/a-castellano/music-manager-job-router/config"
+	"github.com/a-castellano/music-manager-job-router/httpservice"
+	"github.com/a-castellano/music-manager-job-router/logging"
+	"github.com/a-castellano/music-manager-job-router/routing"
+	"github.com/a-castellano/music-manager-job-router/status"
+	"github.com/a-castellano/music-manager-job-router/storage"
 	"github.com/streadway/amqp"
 )
 
@@ -21,13 +28,19 @@ func failOnError(err error, msg string) {
 	}
 }
 
-type RoundTripperMock struct {
-	Response *http.Response
-	RespErr  error
-}
+func readDeadLetter(testConfig config.Config) (amqp.Delivery, bool) {
+	connectionString := "amqp://" + testConfig.Server.User + ":" + testConfig.Server.Password + "@" + testConfig.Server.Host + ":" + strconv.Itoa(testConfig.Server.Port) + "/"
+	conn, err := amqp.Dial(connectionString)
+	failOnError(err, "Failed to stablish connection with RabbitMQ")
+	defer conn.Close()
 
-func (rtm *RoundTripperMock) RoundTrip(*http.Request) (*http.Response, error) {
-	return rtm.Response, rtm.RespErr
+	ch, err := conn.Channel()
+	failOnError(err, "Failed to open dead letter RabbitMQ channel")
+	defer ch.Close()
+
+	delivery, ok, err := ch.Get(testConfig.DeadLetter.Queue, true)
+	failOnError(err, "Failed to read dead letter queue")
+	return delivery, ok
 }
 
 func TestReceiveDie(t *testing.T) {
@@ -38,6 +51,7 @@ func TestReceiveDie(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveDie", Queue: "DeadLetterTestReceiveDie"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -53,15 +67,17 @@ func TestReceiveDie(t *testing.T) {
 	job.LastOrigin = "JobRouter"
 	job.RequiredOrigin = "JobRouter"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
 
-	go func() { wrapperChannel <- job }()
+	go func() { wrapperChannel <- routing.NewJob(job, nil) }()
 
 	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
 	not html code
 		`))}}}
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
 	if err != nil {
 		t.Errorf("TestReceiveDie should end without errors.")
@@ -77,6 +93,7 @@ func TestReceiveNotDieRequiredOriginJobRouter(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveNotDieRequiredOriginJobRouter", Queue: "DeadLetterTestReceiveNotDieRequiredOriginJobRouter"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -92,20 +109,35 @@ func TestReceiveNotDieRequiredOriginJobRouter(t *testing.T) {
 	job.LastOrigin = "JobRouter"
 	job.RequiredOrigin = "JobRouter"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+
+	dieJob := job
+	dieJob.Type = commontypes.Die
 
-	go func() { wrapperChannel <- job }()
+	go func() {
+		wrapperChannel <- routing.NewJob(job, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
+	}()
 
 	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
 	not html code
 		`))}}}
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
-	if err == nil {
-		t.Errorf("TestReceiveNotDieRequiredOriginJobRouter should end with errors.")
+	if err != nil {
+		t.Errorf("TestReceiveNotDieRequiredOriginJobRouter should keep routing jobs after an invalid one.")
 	}
 
+	deadLetter, ok := readDeadLetter(testConfig)
+	if !ok {
+		t.Fatalf("Non Die job addressed to JobRouter should be dead-lettered.")
+	}
+	if deadLetter.Headers["x-jobrouter-reason"] != "invalid-origin" {
+		t.Errorf("Dead letter reason should be 'invalid-origin', not '%v'.", deadLetter.Headers["x-jobrouter-reason"])
+	}
 }
 
 func TestReceiveFinishedJobAndDie(t *testing.T) {
@@ -116,6 +148,7 @@ func TestReceiveFinishedJobAndDie(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveFinishedJobAndDie", Queue: "DeadLetterTestReceiveFinishedJobAndDie"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -138,18 +171,20 @@ func TestReceiveFinishedJobAndDie(t *testing.T) {
 	finishedJob.Type = commontypes.ArtistInfoRetrieval
 	finishedJob.LastOrigin = "first"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
 
 	go func() {
-		wrapperChannel <- finishedJob
-		wrapperChannel <- dieJob
+		wrapperChannel <- routing.NewJob(finishedJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
 	}()
 
 	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
 	not html code
 		`))}}}
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
 	if err != nil {
 		t.Errorf("TestReceiveFinishedJobAndDie should end without errors.")
@@ -165,6 +200,7 @@ func TestReceiveFinishedJobButStatusFails(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveFinishedJobButStatusFails", Queue: "DeadLetterTestReceiveFinishedJobButStatusFails"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -187,21 +223,31 @@ func TestReceiveFinishedJobButStatusFails(t *testing.T) {
 	finishedJob.Type = commontypes.ArtistInfoRetrieval
 	finishedJob.LastOrigin = "first"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
 
 	go func() {
-		wrapperChannel <- finishedJob
-		wrapperChannel <- dieJob
+		wrapperChannel <- routing.NewJob(finishedJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
 	}()
 
 	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 500, Body: ioutil.NopCloser(bytes.NewBufferString(`
 	not html code
 		`))}}}
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
-	if err == nil {
-		t.Errorf("TestReceiveFinishedJobButStatusFails should fail.")
+	if err != nil {
+		t.Errorf("TestReceiveFinishedJobButStatusFails should keep routing jobs when status Manager fails.")
+	}
+
+	deadLetter, ok := readDeadLetter(testConfig)
+	if !ok {
+		t.Fatalf("Job whose status can't be updated should be dead-lettered.")
+	}
+	if deadLetter.Headers["x-jobrouter-reason"] != "status-service-failure" {
+		t.Errorf("Dead letter reason should be 'status-service-failure', not '%v'.", deadLetter.Headers["x-jobrouter-reason"])
 	}
 
 }
@@ -214,6 +260,7 @@ func TestReceiveFailedJobNoMoreWrappersJobAndDie(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveFailedJobNoMoreWrappersJobAndDie", Queue: "DeadLetterTestReceiveFailedJobNoMoreWrappersJobAndDie"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -236,18 +283,20 @@ func TestReceiveFailedJobNoMoreWrappersJobAndDie(t *testing.T) {
 	unfinishedJob.Type = commontypes.ArtistInfoRetrieval
 	unfinishedJob.LastOrigin = "first"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
 
 	go func() {
-		wrapperChannel <- unfinishedJob
-		wrapperChannel <- dieJob
+		wrapperChannel <- routing.NewJob(unfinishedJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
 	}()
 
 	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
 	not html code
 		`))}}}
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
 	if err != nil {
 		t.Errorf("TestReceiveFailedJobNoMoreWrappersJobAndDie should end without errors.")
@@ -267,6 +316,7 @@ func TestReceiveFailedJobOneMoreWrapperJobAndDie(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveFailedJobOneMoreWrapperJobAndDie", Queue: "DeadLetterTestReceiveFailedJobOneMoreWrapperJobAndDie"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -291,14 +341,16 @@ func TestReceiveFailedJobOneMoreWrapperJobAndDie(t *testing.T) {
 	unfinishedJob.Type = commontypes.ArtistInfoRetrieval
 	unfinishedJob.LastOrigin = "first"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
 
 	go func() {
-		wrapperChannel <- unfinishedJob
-		wrapperChannel <- dieJob
+		wrapperChannel <- routing.NewJob(unfinishedJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
 	}()
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
 	connectionString := "amqp://" + testConfig.Server.User + ":" + testConfig.Server.Password + "@" + testConfig.Server.Host + ":" + strconv.Itoa(testConfig.Server.Port) + "/"
 	conn, err := amqp.Dial(connectionString)
@@ -387,6 +439,7 @@ func TestReceiveJobFirstWrapperJobAndDie(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveJobFirstWrapperJobAndDie", Queue: "DeadLetterTestReceiveJobFirstWrapperJobAndDie"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -411,14 +464,16 @@ func TestReceiveJobFirstWrapperJobAndDie(t *testing.T) {
 	unfinishedJob.Type = commontypes.ArtistInfoRetrieval
 	unfinishedJob.LastOrigin = "JobManager"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
 
 	go func() {
-		wrapperChannel <- unfinishedJob
-		wrapperChannel <- dieJob
+		wrapperChannel <- routing.NewJob(unfinishedJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
 	}()
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
 	connectionString := "amqp://" + testConfig.Server.User + ":" + testConfig.Server.Password + "@" + testConfig.Server.Host + ":" + strconv.Itoa(testConfig.Server.Port) + "/"
 	conn, err := amqp.Dial(connectionString)
@@ -507,6 +562,7 @@ func TestReceiveJobRequiredOriginFirstWrapperJobAndDie(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveJobRequiredOriginFirstWrapperJobAndDie", Queue: "DeadLetterTestReceiveJobRequiredOriginFirstWrapperJobAndDie"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -532,14 +588,16 @@ func TestReceiveJobRequiredOriginFirstWrapperJobAndDie(t *testing.T) {
 	unfinishedJob.LastOrigin = "JobManager"
 	unfinishedJob.RequiredOrigin = "second"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
 
 	go func() {
-		wrapperChannel <- unfinishedJob
-		wrapperChannel <- dieJob
+		wrapperChannel <- routing.NewJob(unfinishedJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
 	}()
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
 	connectionString := "amqp://" + testConfig.Server.User + ":" + testConfig.Server.Password + "@" + testConfig.Server.Host + ":" + strconv.Itoa(testConfig.Server.Port) + "/"
 	conn, err := amqp.Dial(connectionString)
@@ -628,6 +686,7 @@ func TestReceiveJobRequiredOriginDoesNotExist(t *testing.T) {
 	testConfig.Server.Port = 5672
 	testConfig.Server.User = "guest"
 	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveJobRequiredOriginDoesNotExist", Queue: "DeadLetterTestReceiveJobRequiredOriginDoesNotExist"}
 	testConfig.JobManager.Name = "JobManager"
 
 	firstwrapper := config.Queue{Name: "first"}
@@ -645,21 +704,381 @@ func TestReceiveJobRequiredOriginDoesNotExist(t *testing.T) {
 	unfinishedJob.LastOrigin = "JobManager"
 	unfinishedJob.RequiredOrigin = "third"
 
-	wrapperChannel := make(chan commontypes.Job)
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+
+	var dieJob commontypes.Job
+
+	dieJob.ID = "TestReceiveJobRequiredOriginDoesNotExist"
+	dieJob.Status = true
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "JobRouter"
+	dieJob.RequiredOrigin = "JobRouter"
 
 	go func() {
-		wrapperChannel <- unfinishedJob
+		wrapperChannel <- routing.NewJob(unfinishedJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
 	}()
 
-	err := RouteJobs(testConfig, wrapperChannel, client)
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
 
-	if err == nil {
-		t.Errorf("TestReceiveJobRequiredOriginDoesNotExist should fail")
+	if err != nil {
+		t.Errorf("TestReceiveJobRequiredOriginDoesNotExist should keep routing jobs after an unroutable one.")
 	}
 
+	deadLetter, ok := readDeadLetter(testConfig)
+	if !ok {
+		t.Fatalf("Job with unknown RequiredOrigin should be dead-lettered.")
+	}
+	if deadLetter.Headers["x-jobrouter-reason"] != "unknown-wrapper" {
+		t.Errorf("Dead letter reason should be 'unknown-wrapper', not '%v'.", deadLetter.Headers["x-jobrouter-reason"])
+	}
 	requiredError := "Wrapper 'third' does not exist."
-	if err.Error() != requiredError {
-		t.Errorf("TestReceiveJobRequiredOriginDoesNotExist error should be %s, not %s.", requiredError, err.Error())
+	if deadLetter.Headers["x-jobrouter-error"] != requiredError {
+		t.Errorf("Dead letter error should be %s, not %v.", requiredError, deadLetter.Headers["x-jobrouter-error"])
+	}
+
+}
+
+func TestRemainingWrappers(t *testing.T) {
+
+	route := []string{"second", "first"}
+
+	remaining := remainingWrappers(route, "second")
+	if len(remaining) != 1 || remaining[0] != "first" {
+		t.Errorf("Remaining wrappers after 'second' should be 'first', not %v.", remaining)
+	}
+	if len(remainingWrappers(route, "first")) != 0 {
+		t.Errorf("There should be no wrapper after 'first'.")
+	}
+	if len(remainingWrappers(route, "third")) != 0 {
+		t.Errorf("There should be no remaining wrappers for a wrapper outside the route.")
+	}
+}
+
+func TestReceiveJobWithoutRouteAndDie(t *testing.T) {
+
+	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
+	not html code
+		`))}}}
+
+	var testConfig config.Config
+
+	testConfig.Server.Host = "rabbitmq"
+	testConfig.Server.Port = 5672
+	testConfig.Server.User = "guest"
+	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestReceiveJobWithoutRouteAndDie", Queue: "DeadLetterTestReceiveJobWithoutRouteAndDie"}
+	testConfig.JobManager.Name = "JobManager"
+
+	firstwrapper := config.Queue{Name: "first"}
+
+	testConfig.Wrappers = append(testConfig.Wrappers, firstwrapper)
+	testConfig.Routes = map[commontypes.JobType][]string{commontypes.ArtistInfoRetrieval: {"first"}}
+
+	var dieJob commontypes.Job
+	var unroutableJob commontypes.Job
+
+	dieJob.ID = "TestReceiveJobWithoutRouteAndDie"
+	dieJob.Status = true
+	dieJob.Finished = false
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "JobRouter"
+	dieJob.RequiredOrigin = "JobRouter"
+
+	unroutableJob.ID = "TestReceiveJobWithoutRouteAndDie"
+	unroutableJob.Status = true
+	unroutableJob.Finished = false
+	unroutableJob.Type = commontypes.RecordInfoRetrieval
+	unroutableJob.LastOrigin = "JobManager"
+
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+
+	go func() {
+		wrapperChannel <- routing.NewJob(unroutableJob, nil)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
+	}()
+
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
+
+	if err != nil {
+		t.Errorf("TestReceiveJobWithoutRouteAndDie should end without errors.")
+	}
+}
+
+func TestFinishedJobIsAcked(t *testing.T) {
+
+	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
+	not html code
+		`))}}}
+
+	var testConfig config.Config
+
+	testConfig.Server.Host = "rabbitmq"
+	testConfig.Server.Port = 5672
+	testConfig.Server.User = "guest"
+	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestFinishedJobIsAcked", Queue: "DeadLetterTestFinishedJobIsAcked"}
+	testConfig.JobManager.Name = "JobManager"
+
+	firstwrapper := config.Queue{Name: "first"}
+
+	testConfig.Wrappers = append(testConfig.Wrappers, firstwrapper)
+
+	var dieJob commontypes.Job
+	var finishedJob commontypes.Job
+
+	dieJob.ID = "TestFinishedJobIsAcked"
+	dieJob.Status = true
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "JobRouter"
+	dieJob.RequiredOrigin = "JobRouter"
+
+	finishedJob.ID = "TestFinishedJobIsAcked"
+	finishedJob.Status = true
+	finishedJob.Finished = true
+	finishedJob.Type = commontypes.ArtistInfoRetrieval
+	finishedJob.LastOrigin = "first"
+
+	delivery := &AcknowledgerMock{}
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+
+	go func() {
+		wrapperChannel <- routing.NewJob(finishedJob, delivery)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
+	}()
+
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
+
+	if err != nil {
+		t.Errorf("TestFinishedJobIsAcked should end without errors.")
+	}
+	if delivery.Acked != 1 || delivery.Requeued != 0 || delivery.Rejected != 0 {
+		t.Errorf("Finished job delivery should only be acked, delivery was %+v.", *delivery)
+	}
+}
+
+func TestFinishedJobIsDeadLetteredWhenStatusFails(t *testing.T) {
+
+	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 500, Body: ioutil.NopCloser(bytes.NewBufferString(`
+	not html code
+		`))}}}
+
+	var testConfig config.Config
+
+	testConfig.Server.Host = "rabbitmq"
+	testConfig.Server.Port = 5672
+	testConfig.Server.User = "guest"
+	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestFinishedJobIsDeadLetteredWhenStatusFails", Queue: "DeadLetterTestFinishedJobIsDeadLetteredWhenStatusFails"}
+	testConfig.JobManager.Name = "JobManager"
+
+	firstwrapper := config.Queue{Name: "first"}
+
+	testConfig.Wrappers = append(testConfig.Wrappers, firstwrapper)
+
+	var finishedJob commontypes.Job
+
+	finishedJob.ID = "TestFinishedJobIsDeadLetteredWhenStatusFails"
+	finishedJob.Status = true
+	finishedJob.Finished = true
+	finishedJob.Type = commontypes.ArtistInfoRetrieval
+	finishedJob.LastOrigin = "first"
+
+	delivery := &AcknowledgerMock{}
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+
+	dieJob := finishedJob
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "JobRouter"
+	dieJob.RequiredOrigin = "JobRouter"
+
+	go func() {
+		wrapperChannel <- routing.NewJob(finishedJob, delivery)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
+	}()
+
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
+
+	if err != nil {
+		t.Errorf("TestFinishedJobIsDeadLetteredWhenStatusFails should end without errors.")
+	}
+	if delivery.Acked != 1 || delivery.Requeued != 0 || delivery.Rejected != 0 {
+		t.Errorf("Dead-lettered job delivery should only be acked, delivery was %+v.", *delivery)
+	}
+}
+
+func TestUnknownRequiredOriginIsDeadLettered(t *testing.T) {
+
+	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
+	not html code
+		`))}}}
+
+	var testConfig config.Config
+
+	testConfig.Server.Host = "rabbitmq"
+	testConfig.Server.Port = 5672
+	testConfig.Server.User = "guest"
+	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestUnknownRequiredOriginIsDeadLettered", Queue: "DeadLetterTestUnknownRequiredOriginIsDeadLettered"}
+	testConfig.JobManager.Name = "JobManager"
+
+	firstwrapper := config.Queue{Name: "first"}
+
+	testConfig.Wrappers = append(testConfig.Wrappers, firstwrapper)
+
+	var unroutableJob commontypes.Job
+
+	unroutableJob.ID = "TestUnknownRequiredOriginIsDeadLettered"
+	unroutableJob.Status = true
+	unroutableJob.Type = commontypes.ArtistInfoRetrieval
+	unroutableJob.LastOrigin = "JobManager"
+	unroutableJob.RequiredOrigin = "third"
+
+	delivery := &AcknowledgerMock{}
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+
+	dieJob := unroutableJob
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "JobRouter"
+	dieJob.RequiredOrigin = "JobRouter"
+
+	go func() {
+		wrapperChannel <- routing.NewJob(unroutableJob, delivery)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
+	}()
+
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
+
+	if err != nil {
+		t.Errorf("TestUnknownRequiredOriginIsDeadLettered should end without errors.")
 	}
+	if delivery.Acked != 1 || delivery.Requeued != 0 || delivery.Rejected != 0 {
+		t.Errorf("Dead-lettered job delivery should only be acked, delivery was %+v.", *delivery)
+	}
+}
+
+func TestStorageFailureDoesNotStopRouter(t *testing.T) {
+
+	client := http.Client{Transport: &HostRoundTripperMock{StatusCodes: map[string]int{"status": 200, "storage": 500}}}
+
+	var testConfig config.Config
+
+	testConfig.Server.Host = "rabbitmq"
+	testConfig.Server.Port = 5672
+	testConfig.Server.User = "guest"
+	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestStorageFailureDoesNotStopRouter", Queue: "DeadLetterTestStorageFailureDoesNotStopRouter"}
+	testConfig.JobManager.Name = "JobManager"
+	testConfig.Status = config.Service{Type: config.HTTPService, Name: "status"}
+	testConfig.Storage = config.Service{Type: config.HTTPService, Name: "storage"}
 
+	firstwrapper := config.Queue{Name: "first"}
+
+	testConfig.Wrappers = append(testConfig.Wrappers, firstwrapper)
+
+	var dieJob commontypes.Job
+	var finishedJob commontypes.Job
+
+	dieJob.ID = "TestStorageFailureDoesNotStopRouter"
+	dieJob.Status = true
+	dieJob.Type = commontypes.Die
+	dieJob.LastOrigin = "JobRouter"
+	dieJob.RequiredOrigin = "JobRouter"
+
+	finishedJob.ID = "TestStorageFailureDoesNotStopRouter"
+	finishedJob.Status = true
+	finishedJob.Finished = true
+	finishedJob.Type = commontypes.ArtistInfoRetrieval
+	finishedJob.LastOrigin = "first"
+
+	delivery := &AcknowledgerMock{}
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+
+	go func() {
+		wrapperChannel <- routing.NewJob(finishedJob, delivery)
+		wrapperChannel <- routing.NewJob(dieJob, nil)
+	}()
+
+	err := RouteJobs(context.Background(), testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
+
+	if err != nil {
+		t.Errorf("TestStorageFailureDoesNotStopRouter should end without errors.")
+	}
+	if delivery.Acked != 1 {
+		t.Errorf("Dead-lettered job delivery should be acked, delivery was %+v.", *delivery)
+	}
+
+	deadLetter, ok := readDeadLetter(testConfig)
+	if !ok {
+		t.Fatalf("Job whose results can't be stored should be dead-lettered.")
+	}
+	if deadLetter.Headers["x-jobrouter-reason"] != "storage-service-failure" {
+		t.Errorf("Dead letter reason should be 'storage-service-failure', not '%v'.", deadLetter.Headers["x-jobrouter-reason"])
+	}
+	deadLetterJob, _ := commontypes.DecodeJob(deadLetter.Body)
+	if deadLetterJob.Status != false || deadLetterJob.Error == "" {
+		t.Errorf("Dead-lettered job should be marked as failed with its error, job was %+v.", deadLetterJob)
+	}
+}
+
+func TestRouteJobsStopsWhenContextIsCancelled(t *testing.T) {
+
+	client := http.Client{Transport: &RoundTripperMock{Response: &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`
+	not html code
+		`))}}}
+
+	var testConfig config.Config
+
+	testConfig.Server.Host = "rabbitmq"
+	testConfig.Server.Port = 5672
+	testConfig.Server.User = "guest"
+	testConfig.Server.Password = "guest"
+	testConfig.DeadLetter = config.DeadLetter{Exchange: "DeadLetterTestRouteJobsStopsWhenContextIsCancelled", Queue: "DeadLetterTestRouteJobsStopsWhenContextIsCancelled"}
+	testConfig.JobManager.Name = "JobManager"
+
+	firstwrapper := config.Queue{Name: "first"}
+
+	testConfig.Wrappers = append(testConfig.Wrappers, firstwrapper)
+
+	var finishedJob commontypes.Job
+
+	finishedJob.ID = "TestRouteJobsStopsWhenContextIsCancelled"
+	finishedJob.Status = true
+	finishedJob.Finished = true
+	finishedJob.Type = commontypes.ArtistInfoRetrieval
+	finishedJob.LastOrigin = "first"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	delivery := &AcknowledgerMock{}
+	wrapperChannel := make(chan routing.Job)
+	session := broker.NewConfirmSession(testConfig.Server, 0)
+	defer session.Close()
+	routeJobsDone := make(chan error)
+
+	go func() {
+		routeJobsDone <- RouteJobs(ctx, testConfig, session, wrapperChannel, status.NewHTTPReporter(client, httpservice.NewEndpoint("status", testConfig.Status)), storage.NewHTTPResultStore(client, httpservice.NewEndpoint("storage", testConfig.Storage)), logging.Discard(), routing.NewPauses(), nil)
+	}()
+
+	wrapperChannel <- routing.NewJob(finishedJob, delivery)
+	cancel()
+
+	err := <-routeJobsDone
+	if err != nil {
+		t.Errorf("RouteJobs should return no errors when its context is cancelled.")
+	}
+	if delivery.Acked != 1 {
+		t.Errorf("Job received before cancelling should be routed, delivery was %+v.", *delivery)
+	}
 }